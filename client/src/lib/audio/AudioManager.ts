@@ -19,6 +19,7 @@ export class AudioManager {
   private pendingCandidates: RTCIceCandidate[] = [];
   private remoteDescriptionSet: boolean = false;
   private audioElement?: HTMLAudioElement;
+  private candidateStream?: EventSource;
 
   constructor(options?: Partial<AudioVisualizerOptions>) {
     log('constructor', 'Initializing AudioManager');
@@ -143,7 +144,10 @@ export class AudioManager {
       this.setState({ connectionStatus: 'connecting' });
 
       log('connect', 'Fetching WebRTC configuration');
-      const configResponse = await fetch('/config');
+      // the session id is baked into the TURN credentials the server issues
+      const configResponse = await fetch('/config', {
+        headers: { 'X-Session-ID': this.sessionManager.getSessionId() }
+      });
       if (!configResponse.ok) {
         throw new Error(`Config fetch failed: ${configResponse.status}`);
       }
@@ -253,12 +257,14 @@ export class AudioManager {
     log('setupWebRTC', 'Setting local description', offer);
     await this.peerConnection.setLocalDescription(offer);
 
-    // Send offer to server
+    // Send offer to server; with trickle the answer comes back before the
+    // server has gathered, and its candidates follow over /ice-candidates
     const offerPayload = {
       sdp: btoa(JSON.stringify({
         type: offer.type,
         sdp: offer.sdp
-      }))
+      })),
+      trickle: true
     };
 
     log('setupWebRTC', 'Sending offer to server');
@@ -289,6 +295,7 @@ export class AudioManager {
     log('setupWebRTC', 'Setting remote description', answer);
     await this.peerConnection.setRemoteDescription(answer);
     this.remoteDescriptionSet = true;
+    this.subscribeServerCandidates();
     log('setupWebRTC', 'WebRTC setup completed successfully');
 
     // Send any pending candidates
@@ -305,6 +312,47 @@ export class AudioManager {
     }
   }
 
+  // server candidates arrive as server-sent events until end-of-candidates.
+  // EventSource can't set headers, so the session rides in the query, and
+  // it resumes with Last-Event-ID by itself if the stream drops
+  private subscribeServerCandidates(): void {
+    this.closeCandidateStream();
+
+    const sessionId = encodeURIComponent(this.sessionManager.getSessionId());
+    const stream = new EventSource(`/ice-candidates?session_id=${sessionId}`);
+    this.candidateStream = stream;
+
+    stream.addEventListener('candidate', async (event) => {
+      const candidate: RTCIceCandidateInit = JSON.parse((event as MessageEvent).data);
+      log('serverCandidate', 'Adding server ICE candidate', candidate);
+      try {
+        await this.peerConnection?.addIceCandidate(candidate);
+      } catch (error) {
+        log('serverCandidate', 'Failed to add server candidate', error);
+      }
+    });
+
+    stream.addEventListener('end-of-candidates', () => {
+      log('serverCandidate', 'Server finished gathering candidates');
+      // closing keeps EventSource from reconnecting once the server is done
+      this.closeCandidateStream();
+    });
+
+    stream.onerror = () => {
+      if (stream.readyState === EventSource.CLOSED) {
+        log('serverCandidate', 'Candidate stream closed by the server');
+        this.closeCandidateStream();
+      }
+    };
+  }
+
+  private closeCandidateStream(): void {
+    if (this.candidateStream) {
+      this.candidateStream.close();
+      this.candidateStream = undefined;
+    }
+  }
+
   private async sendICECandidate(candidate: RTCIceCandidate): Promise<void> {
     const candidateObj = {
       candidate: candidate.candidate,
@@ -347,6 +395,8 @@ export class AudioManager {
         }
       });
 
+      this.closeCandidateStream();
+
       if (this.peerConnection) {
         log('disconnect', 'Closing peer connection');
         this.peerConnection.close();
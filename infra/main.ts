@@ -247,6 +247,13 @@ class AwestruckInfrastructure extends TerraformStack {
       value: process.env.AWESTRUCK_API_KEY || this.node.tryGetContext("awestruckApiKey"),
       description: "Awestruck API key for authentication",
     });
+
+    new SsmParameter(this, "turn-secret", {
+      name: "/awestruck/turn_secret",
+      type: "SecureString",
+      value: process.env.TURN_SECRET || this.node.tryGetContext("turnSecret"),
+      description: "Shared secret signing ephemeral TURN credentials",
+    });
     
     // why we need a network load balancer for webrtc:
     // - handles udp traffic for media streams
@@ -454,8 +461,7 @@ class AwestruckInfrastructure extends TerraformStack {
               { name: "TURN_SERVER_HOST", value: "turn.awestruck.io" },
               { name: "TURN_MIN_PORT", value: TURN_MIN_PORT.toString() },
               { name: "TURN_MAX_PORT", value: TURN_MAX_PORT.toString() },
-              { name: "TURN_USERNAME", value: "awestruck_user" },
-              { name: "TURN_PASSWORD", value: "verySecurePassword1234567890abcdefghijklmnop" }
+              { name: "TURN_SECRET", value: "{{resolve:ssm:/awestruck/turn_secret:1}}" }
             ],
             ulimits: [
               { name: "memlock", softLimit: -1, hardLimit: -1 },
@@ -531,9 +537,7 @@ class AwestruckInfrastructure extends TerraformStack {
               { name: "HEALTH_PORT", value: "3479" },
               { name: "TURN_REALM", value: "awestruck.io" },
               { name: "PUBLIC_IP", value: turnElasticIp.publicIp },
-              { name: "TURN_USERNAME", value: "awestruck_user" },
-              { name: "TURN_PASSWORD", value: "verySecurePassword1234567890abcdefghijklmnop" },
-              { name: "USERS", value: "awestruck_user=verySecurePassword1234567890abcdefghijklmnop" },
+              { name: "TURN_SECRET", value: "{{resolve:ssm:/awestruck/turn_secret:1}}" },
               { name: "TURN_MIN_PORT", value: TURN_MIN_PORT.toString() },
               { name: "TURN_MAX_PORT", value: TURN_MAX_PORT.toString() }
             ],
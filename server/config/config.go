@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 )
 
 // supported environments
@@ -16,12 +18,80 @@ type Config struct {
 	OpenAIAPIKey    string
 	AwestruckAPIKey string
 	TurnServerHost  string
-	TurnUsername    string
-	TurnPassword    string
+	TurnSecret      string
 	TurnMinPort     string
 	TurnMaxPort     string
+
+	// optional settings, defaulted when unset
+	MeterInterval      time.Duration
+	MeterSpectrumBands int
+	RecordingsDir      string
+	MaxRecording       time.Duration
+	RendersDir         string
+	TurnCredentialTTL  time.Duration
+
+	// optional llm providers, registered only when configured
+	AnthropicAPIKey         string
+	OllamaBaseURL           string
+	OpenAICompatibleBaseURL string
+	OpenAICompatibleAPIKey  string
+	SynthRepairAttempts     int
+	SynthGenerationWorkers  int
+
+	// optional background generator, off unless an interval is set
+	GeneratorInterval    time.Duration
+	GeneratorProvider    string
+	GeneratorModel       string
+	GeneratorDailyCalls  int
+	GeneratorDailyTokens int
+
+	// quality gate a generated def must pass before it's served
+	QualityCheckDuration       time.Duration
+	QualityMinPeakDb           float64
+	QualityMinRMSDb            float64
+	QualityMaxRMSDb            float64
+	QualityMaxDCOffset         float64
+	QualityMaxSpectralFlatness float64
+	QualityMaxSilenceRatio     float64
+	QualityMaxClippedRatio     float64
 }
 
+// defaults for optional settings
+const (
+	DefaultMeterInterval      = 100 * time.Millisecond
+	DefaultMeterSpectrumBands = 16
+	DefaultRecordingsDir      = "recordings"
+	DefaultMaxRecording       = time.Hour
+	DefaultRendersDir         = "renders"
+	// turn allocations refresh with the credentials they were made with,
+	// so these have to outlast a long listening session
+	DefaultTurnCredentialTTL = 12 * time.Hour
+	DefaultOllamaBaseURL     = "http://localhost:11434/v1"
+	// follow-ups a model gets to fix code sclang rejected
+	DefaultSynthRepairAttempts = 2
+	// generations talking to a provider at once; the rest queue
+	DefaultSynthGenerationWorkers = 2
+	// provider calls and tokens the background generator may spend per utc day
+	DefaultGeneratorDailyCalls  = 24
+	DefaultGeneratorDailyTokens = 500000
+	// longest offline render accepted, the quality gate's included
+	MaxRenderDuration = 10 * time.Minute
+	// offline render length the quality gate measures
+	DefaultQualityCheckDuration = 30 * time.Second
+	// quieter than this at its loudest, or on average, is effectively silent
+	DefaultQualityMinPeakDb = -40.0
+	DefaultQualityMinRMSDb  = -50.0
+	// louder than this on average is a wall of sound or runaway feedback
+	DefaultQualityMaxRMSDb = -3.0
+	// a mean sample value past this wastes headroom and thumps on start
+	DefaultQualityMaxDCOffset = 0.05
+	// white noise measures about 0.56; musical material sits far below
+	DefaultQualityMaxSpectralFlatness = 0.45
+	DefaultQualityMaxSilenceRatio     = 0.5
+	// more than one sample in a thousand at full scale is audible clipping
+	DefaultQualityMaxClippedRatio = 0.001
+)
+
 var globalConfig *Config
 
 // loads environment variables and applies defaults
@@ -36,13 +106,82 @@ func LoadFromEnv() Config {
 		OpenAIAPIKey:    os.Getenv("OPENAI_API_KEY"),
 		AwestruckAPIKey: os.Getenv("AWESTRUCK_API_KEY"),
 		TurnServerHost:  os.Getenv("TURN_SERVER_HOST"),
-		TurnUsername:    os.Getenv("TURN_USERNAME"),
-		TurnPassword:    os.Getenv("TURN_PASSWORD"),
+		TurnSecret:      os.Getenv("TURN_SECRET"),
 		TurnMinPort:     os.Getenv("TURN_MIN_PORT"),
 		TurnMaxPort:     os.Getenv("TURN_MAX_PORT"),
+
+		MeterInterval:      getEnvDuration("METER_INTERVAL_MS", time.Millisecond, DefaultMeterInterval),
+		MeterSpectrumBands: getEnvInt("METER_SPECTRUM_BANDS", DefaultMeterSpectrumBands),
+		RecordingsDir:      getEnv("RECORDINGS_DIR", DefaultRecordingsDir),
+		MaxRecording:       getEnvDuration("RECORDING_MAX_SECONDS", time.Second, DefaultMaxRecording),
+		RendersDir:         getEnv("RENDERS_DIR", DefaultRendersDir),
+		TurnCredentialTTL:  getEnvDuration("TURN_CREDENTIAL_TTL_SECONDS", time.Second, DefaultTurnCredentialTTL),
+
+		AnthropicAPIKey:         os.Getenv("ANTHROPIC_API_KEY"),
+		OllamaBaseURL:           getEnv("OLLAMA_BASE_URL", DefaultOllamaBaseURL),
+		OpenAICompatibleBaseURL: os.Getenv("OPENAI_COMPATIBLE_BASE_URL"),
+		OpenAICompatibleAPIKey:  os.Getenv("OPENAI_COMPATIBLE_API_KEY"),
+		SynthRepairAttempts:     getEnvInt("SYNTH_REPAIR_ATTEMPTS", DefaultSynthRepairAttempts),
+		SynthGenerationWorkers:  getEnvInt("SYNTH_GENERATION_WORKERS", DefaultSynthGenerationWorkers),
+
+		GeneratorInterval:    getEnvDuration("SYNTH_GENERATOR_INTERVAL_MINUTES", time.Minute, 0),
+		GeneratorProvider:    os.Getenv("SYNTH_GENERATOR_PROVIDER"),
+		GeneratorModel:       os.Getenv("SYNTH_GENERATOR_MODEL"),
+		GeneratorDailyCalls:  getEnvInt("SYNTH_GENERATOR_DAILY_CALLS", DefaultGeneratorDailyCalls),
+		GeneratorDailyTokens: getEnvInt("SYNTH_GENERATOR_DAILY_TOKENS", DefaultGeneratorDailyTokens),
+
+		QualityCheckDuration:       getEnvDuration("QUALITY_CHECK_SECONDS", time.Second, DefaultQualityCheckDuration),
+		QualityMinPeakDb:           getEnvFloat("QUALITY_MIN_PEAK_DB", DefaultQualityMinPeakDb),
+		QualityMinRMSDb:            getEnvFloat("QUALITY_MIN_RMS_DB", DefaultQualityMinRMSDb),
+		QualityMaxRMSDb:            getEnvFloat("QUALITY_MAX_RMS_DB", DefaultQualityMaxRMSDb),
+		QualityMaxDCOffset:         getEnvFloat("QUALITY_MAX_DC_OFFSET", DefaultQualityMaxDCOffset),
+		QualityMaxSpectralFlatness: getEnvFloat("QUALITY_MAX_SPECTRAL_FLATNESS", DefaultQualityMaxSpectralFlatness),
+		QualityMaxSilenceRatio:     getEnvFloat("QUALITY_MAX_SILENCE_RATIO", DefaultQualityMaxSilenceRatio),
+		QualityMaxClippedRatio:     getEnvFloat("QUALITY_MAX_CLIPPED_RATIO", DefaultQualityMaxClippedRatio),
 	}
 }
 
+// reads an env var, falling back to def when unset
+func getEnv(name string, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// reads an integer env var, falling back to def when unset or invalid
+func getEnvInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid %s=%q, using default %d\n", name, value, def)
+		return def
+	}
+	return n
+}
+
+// reads a float env var, falling back to def when unset or invalid
+func getEnvFloat(name string, def float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid %s=%q, using default %g\n", name, value, def)
+		return def
+	}
+	return f
+}
+
+// reads an integer env var as a count of unit, e.g. METER_INTERVAL_MS
+func getEnvDuration(name string, unit time.Duration, def time.Duration) time.Duration {
+	return time.Duration(getEnvInt(name, int(def/unit))) * unit
+}
+
 // validates the configuration
 func (c *Config) validate() error {
 	// check for empty required fields
@@ -50,8 +189,7 @@ func (c *Config) validate() error {
 		"OpenAIAPIKey":    c.OpenAIAPIKey,
 		"AwestruckAPIKey": c.AwestruckAPIKey,
 		"TurnServerHost":  c.TurnServerHost,
-		"TurnUsername":    c.TurnUsername,
-		"TurnPassword":    c.TurnPassword,
+		"TurnSecret":      c.TurnSecret,
 		"TurnMinPort":     c.TurnMinPort,
 		"TurnMaxPort":     c.TurnMaxPort,
 	}
@@ -62,6 +200,44 @@ func (c *Config) validate() error {
 		}
 	}
 
+	if c.MeterInterval < 10*time.Millisecond {
+		return fmt.Errorf("MeterInterval must be at least 10ms, got: %v", c.MeterInterval)
+	}
+	if c.MeterSpectrumBands < 1 || c.MeterSpectrumBands > 1024 {
+		return fmt.Errorf("MeterSpectrumBands must be between 1 and 1024, got: %d", c.MeterSpectrumBands)
+	}
+
+	if c.MaxRecording <= 0 {
+		return fmt.Errorf("MaxRecording must be positive, got: %v", c.MaxRecording)
+	}
+
+	if c.SynthRepairAttempts < 0 {
+		return fmt.Errorf("SynthRepairAttempts can't be negative, got: %d", c.SynthRepairAttempts)
+	}
+	if c.SynthGenerationWorkers < 1 {
+		return fmt.Errorf("SynthGenerationWorkers must be at least 1, got: %d", c.SynthGenerationWorkers)
+	}
+	if c.GeneratorInterval < 0 {
+		return fmt.Errorf("GeneratorInterval can't be negative, got: %v", c.GeneratorInterval)
+	}
+	if c.GeneratorDailyCalls < 1 || c.GeneratorDailyTokens < 1 {
+		return fmt.Errorf("GeneratorDailyCalls and GeneratorDailyTokens must be positive, got: %d and %d",
+			c.GeneratorDailyCalls, c.GeneratorDailyTokens)
+	}
+
+	if c.QualityCheckDuration <= 0 || c.QualityCheckDuration > MaxRenderDuration {
+		return fmt.Errorf("QualityCheckDuration must be positive and at most %v, got: %v",
+			MaxRenderDuration, c.QualityCheckDuration)
+	}
+	if c.QualityMinRMSDb >= c.QualityMaxRMSDb {
+		return fmt.Errorf("QualityMinRMSDb must be below QualityMaxRMSDb, got: %g and %g",
+			c.QualityMinRMSDb, c.QualityMaxRMSDb)
+	}
+
+	if c.TurnCredentialTTL <= 0 {
+		return fmt.Errorf("TurnCredentialTTL must be positive, got: %v", c.TurnCredentialTTL)
+	}
+
 	// validate environment
 	switch c.Environment {
 	case EnvDevelopment, EnvProduction:
@@ -92,6 +268,11 @@ func Get() *Config {
 	return globalConfig
 }
 
+// gets the current configuration, if it has been initialized
+func Lookup() (*Config, bool) {
+	return globalConfig, globalConfig != nil
+}
+
 // validates an API key against the configured one
 func ValidateAwestruckAPIKey(key string) bool {
 	return globalConfig != nil && key == globalConfig.AwestruckAPIKey
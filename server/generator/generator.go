@@ -0,0 +1,254 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/po-studio/server/config"
+	"github.com/po-studio/server/llm"
+	sc "github.com/po-studio/server/supercollider"
+)
+
+// run outcomes
+const (
+	// passed the checks and was added to the library
+	RunAccepted = "accepted"
+	// compiled but failed the quality gate and was quarantined
+	RunRejected = "rejected"
+	// generation or the quality check errored
+	RunFailed = "failed"
+	// not attempted, e.g. the day's budget is spent
+	RunSkipped = "skipped"
+)
+
+// runs kept for the status endpoint
+const maxRecentRuns = 50
+
+// Budget is what the generator has spent today (utc) against its limits
+type Budget struct {
+	Day        string `json:"day"`
+	Calls      int    `json:"calls"`
+	CallLimit  int    `json:"call_limit"`
+	Tokens     int    `json:"tokens"`
+	TokenLimit int    `json:"token_limit"`
+}
+
+// Run is one scheduled generation and what became of it
+type Run struct {
+	Subject    string            `json:"subject"`
+	Style      string            `json:"style"`
+	Outcome    string            `json:"outcome"`
+	Reason     string            `json:"reason,omitempty"`
+	JobId      string            `json:"job_id,omitempty"`
+	SynthDef   string            `json:"synthdef,omitempty"`
+	Quality    *sc.QualityReport `json:"quality,omitempty"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt time.Time         `json:"finished_at"`
+}
+
+// Status is the generator's schedule, budget and recent runs
+type Status struct {
+	Enabled         bool       `json:"enabled"`
+	IntervalMinutes float64    `json:"interval_minutes,omitempty"`
+	NextRunAt       *time.Time `json:"next_run_at,omitempty"`
+	Budget          Budget     `json:"budget"`
+	Recent          []Run      `json:"recent"`
+}
+
+// why the library grows itself:
+// - listeners cycle through the same handful of hand-written defs
+// - a few generations a day cost little next to writing one by hand
+// - generation jobs only publish what passes the quality gate
+type Generator struct {
+	interval time.Duration
+	provider string
+	model    string
+	jobs     *llm.JobManager
+
+	mu      sync.Mutex
+	budget  Budget
+	next    int
+	nextRun time.Time
+	recent  []Run
+	started bool
+}
+
+var (
+	defaultGenerator     *Generator
+	defaultGeneratorOnce sync.Once
+)
+
+// Default returns the generator configured from the environment
+func Default() *Generator {
+	defaultGeneratorOnce.Do(func() {
+		cfg := config.Get()
+		defaultGenerator = &Generator{
+			interval: cfg.GeneratorInterval,
+			provider: cfg.GeneratorProvider,
+			model:    cfg.GeneratorModel,
+			jobs:     llm.DefaultJobs(),
+			budget: Budget{
+				CallLimit:  cfg.GeneratorDailyCalls,
+				TokenLimit: cfg.GeneratorDailyTokens,
+			},
+			// so a restart doesn't always begin with the same prompt
+			next: time.Now().YearDay(),
+		}
+	})
+	return defaultGenerator
+}
+
+// Start runs a generation every interval, the first one interval from now
+// so a crash loop can't spend the budget. It does nothing when no
+// interval is configured.
+func (g *Generator) Start() {
+	if g.interval <= 0 {
+		log.Printf("[GENERATOR] Disabled; set SYNTH_GENERATOR_INTERVAL_MINUTES to enable")
+		return
+	}
+
+	g.mu.Lock()
+	if g.started {
+		g.mu.Unlock()
+		return
+	}
+	g.started = true
+	g.nextRun = time.Now().Add(g.interval)
+	g.mu.Unlock()
+
+	log.Printf("[GENERATOR] Generating a synth every %v (budget %d calls, %d tokens a day)",
+		g.interval, g.budget.CallLimit, g.budget.TokenLimit)
+
+	go func() {
+		ticker := time.NewTicker(g.interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			g.mu.Lock()
+			g.nextRun = time.Now().Add(g.interval)
+			g.mu.Unlock()
+			g.runOnce()
+		}
+	}()
+}
+
+// Status reports the schedule, today's spend and recent runs
+func (g *Generator) Status() Status {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.rollBudgetLocked(time.Now())
+
+	status := Status{
+		Enabled: g.started,
+		Budget:  g.budget,
+		Recent:  append([]Run(nil), g.recent...),
+	}
+	if g.started {
+		status.IntervalMinutes = g.interval.Minutes()
+		nextRun := g.nextRun
+		status.NextRunAt = &nextRun
+	}
+	return status
+}
+
+func (g *Generator) runOnce() {
+	g.mu.Lock()
+	prompt, subject, style := promptAt(g.next)
+	g.next++
+	g.mu.Unlock()
+
+	run := Run{Subject: subject, Style: style, StartedAt: time.Now()}
+	defer func() {
+		run.FinishedAt = time.Now()
+		g.record(run)
+	}()
+
+	if reason := g.overBudget(); reason != "" {
+		run.Outcome, run.Reason = RunSkipped, reason
+		return
+	}
+
+	job, err := g.jobs.Submit(llm.GenerationRequest{Prompt: prompt, Provider: g.provider, Model: g.model})
+	if err != nil {
+		run.Outcome, run.Reason = RunSkipped, err.Error()
+		return
+	}
+	run.JobId = job.Id
+	log.Printf("[GENERATOR] Generating %q in the style of %q as job %s", subject, style, job.Id)
+
+	// every provider call has its own timeout, so the job always finishes
+	job, err = g.jobs.Wait(context.Background(), job.Id)
+	if err != nil {
+		run.Outcome, run.Reason = RunFailed, err.Error()
+		return
+	}
+	g.spend(job)
+	run.SynthDef = job.SynthDef
+	run.Quality = job.Quality
+
+	switch job.State {
+	case llm.JobReady:
+		run.Outcome = RunAccepted
+	case llm.JobQuarantined:
+		run.Outcome, run.Reason = RunRejected, job.Error
+	default:
+		run.Outcome, run.Reason = RunFailed, job.Error
+	}
+}
+
+// overBudget says why no generation may start today, if none may
+func (g *Generator) overBudget() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.rollBudgetLocked(time.Now())
+
+	// a generation can take every repair turn, so it has to fit whole
+	if calls := llm.MaxGenerationAttempts(); g.budget.Calls+calls > g.budget.CallLimit {
+		return fmt.Sprintf("daily call budget spent (%d of %d, a generation may take %d)",
+			g.budget.Calls, g.budget.CallLimit, calls)
+	}
+	// only output is capped, so the input a run spends can still overshoot
+	if tokens := llm.MaxGenerationOutputTokens(); g.budget.Tokens+tokens > g.budget.TokenLimit {
+		return fmt.Sprintf("daily token budget spent (%d of %d, a generation may take %d)",
+			g.budget.Tokens, g.budget.TokenLimit, tokens)
+	}
+	return ""
+}
+
+func (g *Generator) spend(job llm.Job) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.rollBudgetLocked(time.Now())
+
+	// a call that errored may still have been billed
+	calls := job.Attempts
+	if calls == 0 {
+		calls = 1
+	}
+	g.budget.Calls += calls
+	if job.Usage != nil {
+		g.budget.Tokens += job.Usage.InputTokens + job.Usage.OutputTokens
+	}
+}
+
+func (g *Generator) rollBudgetLocked(now time.Time) {
+	day := now.UTC().Format("2006-01-02")
+	if g.budget.Day != day {
+		g.budget.Day = day
+		g.budget.Calls = 0
+		g.budget.Tokens = 0
+	}
+}
+
+func (g *Generator) record(run Run) {
+	log.Printf("[GENERATOR] %s %s: %s", run.Outcome, run.SynthDef, run.Reason)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.recent = append(g.recent, run)
+	if len(g.recent) > maxRecentRuns {
+		g.recent = g.recent[len(g.recent)-maxRecentRuns:]
+	}
+}
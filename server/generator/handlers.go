@@ -0,0 +1,21 @@
+package generator
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/po-studio/server/config"
+)
+
+// HandleStatus reports the background generator's schedule, today's
+// spend against its budget and what recent runs produced
+func HandleStatus(w http.ResponseWriter, r *http.Request) {
+	apiKey := r.Header.Get("Awestruck-API-Key")
+	if apiKey == "" || !config.ValidateAwestruckAPIKey(apiKey) {
+		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Default().Status())
+}
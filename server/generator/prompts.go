@@ -0,0 +1,34 @@
+package generator
+
+import "fmt"
+
+// what each generation is about. Its length and the number of styles are
+// coprime, so rotating through both reaches every pairing.
+var subjects = []string{
+	"a slowly breathing pad built on a minor ninth chord, with a melody that surfaces every minute or so",
+	"glassy bell tones scattered sparsely over a warm, low drone",
+	"a tidal wash of filtered noise with a quiet pentatonic melody inside it",
+	"a lullaby-like arpeggio that drifts in and out of focus",
+	"deep sub-bass swells under slowly shimmering high partials",
+	"a distant choir of detuned voices holding long suspended chords",
+	"soft plucked tones falling like rain onto a sustained fifth",
+}
+
+// how it should sound
+var styles = []string{
+	"Brian Eno's generative ambient records",
+	"Japanese environmental music of the 1980s",
+	"dub techno, with long tape-like delays and no drums",
+	"minimalist phase music, with patterns drifting against each other",
+	"warm, slightly worn lo-fi tape textures",
+}
+
+// promptAt returns the n'th prompt in the rotation
+func promptAt(n int) (prompt, subject, style string) {
+	subject = subjects[n%len(subjects)]
+	style = styles[n%len(styles)]
+	prompt = fmt.Sprintf(`Generate a single SuperCollider SynthDef for a continuously evolving piece of ambient music: %s.
+Take inspiration from %s.
+It will play unattended for a long time, so it must never fall silent, clip or build up runaway feedback.`, subject, style)
+	return prompt, subject, style
+}
@@ -7,6 +7,7 @@
 
 typedef struct SampleHandlerUserData {
   int pipelineId;
+  GstElement *pipeline;
 } SampleHandlerUserData;
 
 GMainLoop *gstreamer_send_main_loop = NULL;
@@ -16,25 +17,109 @@ void gstreamer_send_start_mainloop(void) {
   g_main_loop_run(gstreamer_send_main_loop);
 }
 
+// level posts one rms/peak value per channel, in dB
+static void gstreamer_send_handle_level(const GstStructure *st, int pipelineId) {
+  const GValue *rms_value = gst_structure_get_value(st, "rms");
+  const GValue *peak_value = gst_structure_get_value(st, "peak");
+  if (rms_value == NULL || peak_value == NULL) {
+    return;
+  }
+
+  G_GNUC_BEGIN_IGNORE_DEPRECATIONS
+  GValueArray *rms_array = (GValueArray *)g_value_get_boxed(rms_value);
+  GValueArray *peak_array = (GValueArray *)g_value_get_boxed(peak_value);
+  guint channels = MIN(rms_array->n_values, peak_array->n_values);
+  channels = MIN(channels, GST_METER_MAX_CHANNELS);
+
+  double rms[GST_METER_MAX_CHANNELS];
+  double peak[GST_METER_MAX_CHANNELS];
+  for (guint i = 0; i < channels; i++) {
+    rms[i] = g_value_get_double(g_value_array_get_nth(rms_array, i));
+    peak[i] = g_value_get_double(g_value_array_get_nth(peak_array, i));
+  }
+  G_GNUC_END_IGNORE_DEPRECATIONS
+
+  goHandlePipelineLevel(rms, peak, channels, pipelineId);
+}
+
+// spectrum posts one magnitude per band, in dB, averaged across channels
+static void gstreamer_send_handle_spectrum(const GstStructure *st, int pipelineId) {
+  const GValue *magnitudes = gst_structure_get_value(st, "magnitude");
+  if (magnitudes == NULL || !GST_VALUE_HOLDS_LIST(magnitudes)) {
+    return;
+  }
+
+  guint bands = gst_value_list_get_size(magnitudes);
+  if (bands == 0) {
+    return;
+  }
+
+  float *values = g_new(float, bands);
+  for (guint i = 0; i < bands; i++) {
+    values[i] = g_value_get_float(gst_value_list_get_value(magnitudes, i));
+  }
+
+  goHandlePipelineSpectrum(values, bands, pipelineId);
+  g_free(values);
+}
+
 static gboolean gstreamer_send_bus_call(GstBus *bus, GstMessage *msg, gpointer data) {
+  SampleHandlerUserData *s = (SampleHandlerUserData *)data;
+
   switch (GST_MESSAGE_TYPE(msg)) {
 
+  case GST_MESSAGE_ELEMENT: {
+    const GstStructure *st = gst_message_get_structure(msg);
+    if (st == NULL) {
+      break;
+    }
+    if (gst_structure_has_name(st, "level")) {
+      gstreamer_send_handle_level(st, s->pipelineId);
+    } else if (gst_structure_has_name(st, "spectrum")) {
+      gstreamer_send_handle_spectrum(st, s->pipelineId);
+    }
+    break;
+  }
+
   case GST_MESSAGE_EOS:
-    g_print("End of stream\n");
-    exit(1);
+    goHandlePipelineBusMessage(s->pipelineId, PIPELINE_BUS_EOS, GST_OBJECT_NAME(GST_MESSAGE_SRC(msg)), NULL, NULL, 0, 0);
     break;
 
-  case GST_MESSAGE_ERROR: {
-    gchar *debug;
-    GError *error;
+  case GST_MESSAGE_ERROR:
+  case GST_MESSAGE_WARNING: {
+    gchar *debug = NULL;
+    GError *error = NULL;
+    int type = PIPELINE_BUS_ERROR;
 
-    gst_message_parse_error(msg, &error, &debug);
-    g_free(debug);
+    if (GST_MESSAGE_TYPE(msg) == GST_MESSAGE_ERROR) {
+      gst_message_parse_error(msg, &error, &debug);
+    } else {
+      gst_message_parse_warning(msg, &error, &debug);
+      type = PIPELINE_BUS_WARNING;
+    }
 
-    g_printerr("Error: %s\n", error->message);
+    goHandlePipelineBusMessage(s->pipelineId, type, GST_OBJECT_NAME(GST_MESSAGE_SRC(msg)), error->message, debug, 0, 0);
     g_error_free(error);
-    exit(1);
+    g_free(debug);
+    break;
+  }
+
+  case GST_MESSAGE_STATE_CHANGED: {
+    // only the pipeline's own transitions, not every element's
+    if (GST_MESSAGE_SRC(msg) != GST_OBJECT(s->pipeline)) {
+      break;
+    }
+    GstState old_state, new_state;
+    gst_message_parse_state_changed(msg, &old_state, &new_state, NULL);
+    goHandlePipelineBusMessage(s->pipelineId, PIPELINE_BUS_STATE_CHANGED, GST_OBJECT_NAME(GST_MESSAGE_SRC(msg)), NULL, NULL, old_state, new_state);
+    break;
   }
+
+  case GST_MESSAGE_LATENCY:
+    gst_bin_recalculate_latency(GST_BIN(s->pipeline));
+    goHandlePipelineBusMessage(s->pipelineId, PIPELINE_BUS_LATENCY, GST_OBJECT_NAME(GST_MESSAGE_SRC(msg)), NULL, NULL, 0, 0);
+    break;
+
   default:
     break;
   }
@@ -76,9 +161,10 @@ GstElement *gstreamer_send_create_pipeline(char *pipeline) {
 void gstreamer_send_start_pipeline(GstElement *pipeline, int pipelineId) {
   SampleHandlerUserData *s = calloc(1, sizeof(SampleHandlerUserData));
   s->pipelineId = pipelineId;
+  s->pipeline = pipeline;
 
   GstBus *bus = gst_pipeline_get_bus(GST_PIPELINE(pipeline));
-  gst_bus_add_watch(bus, gstreamer_send_bus_call, NULL);
+  gst_bus_add_watch(bus, gstreamer_send_bus_call, s);
   gst_object_unref(bus);
 
   GstElement *appsink = gst_bin_get_by_name(GST_BIN(pipeline), "appsink");
@@ -91,6 +177,146 @@ void gstreamer_send_start_pipeline(GstElement *pipeline, int pipelineId) {
 
 void gstreamer_send_stop_pipeline(GstElement *pipeline) {
   gst_element_set_state(pipeline, GST_STATE_NULL);
+
+  GstBus *bus = gst_pipeline_get_bus(GST_PIPELINE(pipeline));
+  gst_bus_remove_watch(bus);
+  gst_object_unref(bus);
+}
+
+int gstreamer_send_set_opus_encoder(GstElement *pipeline, char *name,
+                                    int bitrate, int packetLossPercentage,
+                                    int fec) {
+  GstElement *encoder = gst_bin_get_by_name(GST_BIN(pipeline), name);
+  if (encoder == NULL) {
+    return 0;
+  }
+
+  g_object_set(encoder, "bitrate", bitrate, "packet-loss-percentage",
+               packetLossPercentage, "inband-fec", fec ? TRUE : FALSE, NULL);
+  gst_object_unref(encoder);
+  return 1;
+}
+
+// why recordings are a separate bin on the tee:
+// - it can be added and removed while the stream keeps playing
+// - EOS sent into the bin finalizes the file without ending the pipeline
+struct PipelineRecording {
+  GstElement *pipeline;
+  GstElement *bin;
+  GstPad *teePad;
+  int recordingId;
+  gint unlinked;
+};
+
+// runs on the main loop once EOS has reached the file sink
+static gboolean gstreamer_recording_finish(gpointer data) {
+  PipelineRecording *r = data;
+
+  gst_element_set_state(r->bin, GST_STATE_NULL);
+  gst_bin_remove(GST_BIN(r->pipeline), r->bin);
+
+  GstElement *tee = gst_pad_get_parent_element(r->teePad);
+  if (tee != NULL) {
+    gst_element_release_request_pad(tee, r->teePad);
+    gst_object_unref(tee);
+  }
+  gst_object_unref(r->teePad);
+
+  goHandleRecordingFinished(r->recordingId);
+  free(r);
+  return G_SOURCE_REMOVE;
+}
+
+static GstPadProbeReturn gstreamer_recording_eos_probe(GstPad *pad,
+                                                       GstPadProbeInfo *info,
+                                                       gpointer data) {
+  if (GST_EVENT_TYPE(GST_PAD_PROBE_INFO_EVENT(info)) != GST_EVENT_EOS) {
+    return GST_PAD_PROBE_OK;
+  }
+  g_idle_add(gstreamer_recording_finish, data);
+  return GST_PAD_PROBE_REMOVE;
+}
+
+// the tee pad is idle here, so nothing is mid-push when we unlink
+static GstPadProbeReturn gstreamer_recording_unlink_probe(GstPad *teePad,
+                                                          GstPadProbeInfo *info,
+                                                          gpointer data) {
+  PipelineRecording *r = data;
+  if (!g_atomic_int_compare_and_exchange(&r->unlinked, 0, 1)) {
+    return GST_PAD_PROBE_REMOVE;
+  }
+
+  GstPad *binPad = gst_element_get_static_pad(r->bin, "sink");
+  gst_pad_unlink(teePad, binPad);
+  gst_pad_send_event(binPad, gst_event_new_eos());
+  gst_object_unref(binPad);
+  return GST_PAD_PROBE_REMOVE;
+}
+
+PipelineRecording *gstreamer_send_start_recording(GstElement *pipeline,
+                                             char *teeName, char *description,
+                                             int recordingId) {
+  GError *error = NULL;
+  GstElement *bin = gst_parse_bin_from_description(description, TRUE, &error);
+  if (error != NULL) {
+    g_printerr("Failed to create recording bin: %s\n", error->message);
+    g_error_free(error);
+  }
+  if (bin == NULL) {
+    return NULL;
+  }
+
+  GstElement *tee = gst_bin_get_by_name(GST_BIN(pipeline), teeName);
+  GstElement *sink = gst_bin_get_by_name(GST_BIN(bin), "sink");
+  if (tee == NULL || sink == NULL) {
+    if (tee != NULL) {
+      gst_object_unref(tee);
+    }
+    if (sink != NULL) {
+      gst_object_unref(sink);
+    }
+    gst_object_unref(gst_object_ref_sink(bin));
+    return NULL;
+  }
+
+  PipelineRecording *r = calloc(1, sizeof(PipelineRecording));
+  r->pipeline = pipeline;
+  r->bin = bin;
+  r->recordingId = recordingId;
+
+  GstPad *sinkPad = gst_element_get_static_pad(sink, "sink");
+  gst_pad_add_probe(sinkPad, GST_PAD_PROBE_TYPE_EVENT_DOWNSTREAM,
+                    gstreamer_recording_eos_probe, r, NULL);
+  gst_object_unref(sinkPad);
+  gst_object_unref(sink);
+
+  gst_bin_add(GST_BIN(pipeline), bin);
+  gst_element_sync_state_with_parent(bin);
+
+  r->teePad = gst_element_get_request_pad(tee, "src_%u");
+  gst_object_unref(tee);
+
+  GstPad *binPad = gst_element_get_static_pad(bin, "sink");
+  GstPadLinkReturn linked = gst_pad_link(r->teePad, binPad);
+  gst_object_unref(binPad);
+
+  if (linked != GST_PAD_LINK_OK) {
+    g_printerr("Failed to link recording bin: %d\n", linked);
+    gst_element_set_state(bin, GST_STATE_NULL);
+    gst_bin_remove(GST_BIN(pipeline), bin);
+    tee = gst_pad_get_parent_element(r->teePad);
+    gst_element_release_request_pad(tee, r->teePad);
+    gst_object_unref(tee);
+    gst_object_unref(r->teePad);
+    free(r);
+    return NULL;
+  }
+
+  return r;
 }
 
+void gstreamer_send_stop_recording(PipelineRecording *r) {
+  gst_pad_add_probe(r->teePad, GST_PAD_PROBE_TYPE_IDLE,
+                    gstreamer_recording_unlink_probe, r, NULL);
+}
 
@@ -13,8 +13,11 @@ package gst
 import "C"
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"strings"
 	"sync"
 	"time"
 	"unsafe"
@@ -35,12 +38,44 @@ type Pipeline struct {
 	id        int
 	codecName string
 	clockRate float32
+
+	// set before Start; called from the glib main loop
+	onLevel      func(Level)
+	onSpectrum   func([]float32)
+	onBusMessage func(BusMessage)
+}
+
+// bus message types
+const (
+	BusError        = "error"
+	BusWarning      = "warning"
+	BusEOS          = "eos"
+	BusStateChanged = "state_changed"
+	BusLatency      = "latency"
+)
+
+// BusMessage is a message from a pipeline's bus. Errors and EOS no longer
+// exit the process; it's up to the owner to restart or tear down.
+type BusMessage struct {
+	Type     string `json:"type"`
+	Source   string `json:"source,omitempty"`
+	Message  string `json:"message,omitempty"`
+	Debug    string `json:"debug,omitempty"`
+	OldState string `json:"old_state,omitempty"`
+	NewState string `json:"new_state,omitempty"`
+}
+
+// Level is one reading from a level element, one value per channel in dB
+type Level struct {
+	RMS  []float64
+	Peak []float64
 }
 
 // nolint
 var (
-	pipelines     = make(map[int]*Pipeline)
-	pipelinesLock sync.Mutex
+	pipelines      = make(map[int]*Pipeline)
+	pipelinesLock  sync.Mutex
+	nextPipelineId int
 )
 
 const (
@@ -59,6 +94,15 @@ func logWithTime(format string, v ...interface{}) {
 
 // CreatePipeline creates a GStreamer Pipeline
 func CreatePipeline(codecName string, tracks []*webrtc.TrackLocalStaticSample, pipelineSrc string) *Pipeline {
+	return createPipeline(codecName, tracks, pipelineSrc, DefaultOpusOptions())
+}
+
+// CreateOpusPipeline creates an Opus pipeline with the given encoder settings
+func CreateOpusPipeline(tracks []*webrtc.TrackLocalStaticSample, pipelineSrc string, opus OpusOptions) *Pipeline {
+	return createPipeline("opus", tracks, pipelineSrc, opus)
+}
+
+func createPipeline(codecName string, tracks []*webrtc.TrackLocalStaticSample, pipelineSrc string, opus OpusOptions) *Pipeline {
 	logWithTime("[GST] Creating pipeline: codec=%s tracks=%d", codecName, len(tracks))
 
 	pipelineStr := "appsink name=appsink"
@@ -78,9 +122,10 @@ func CreatePipeline(codecName string, tracks []*webrtc.TrackLocalStaticSample, p
 		clockRate = videoClockRate
 
 	case "opus":
-		pipelineStr = pipelineSrc + " ! opusenc frame-size=20 complexity=10 bitrate=128000 ! " + pipelineStr
+		pipelineStr = pipelineSrc + " ! " + opus.elements() + " ! " + pipelineStr
 		clockRate = audioClockRate
-		logWithTime("[GST] Configured Opus encoder: rate=%f", clockRate)
+		logWithTime("[GST] Configured Opus encoder: rate=%f channels=%d bitrate=%d fec=%v dtx=%v",
+			clockRate, opus.Channels, opus.Bitrate, opus.FEC, opus.DTX)
 
 	case "g722":
 		pipelineStr = pipelineSrc + " ! avenc_g722 ! " + pipelineStr
@@ -105,10 +150,14 @@ func CreatePipeline(codecName string, tracks []*webrtc.TrackLocalStaticSample, p
 	pipelinesLock.Lock()
 	defer pipelinesLock.Unlock()
 
+	// ids are never reused, so a stopped pipeline's late callbacks can't
+	// land on its replacement
+	nextPipelineId++
+
 	pipeline := &Pipeline{
 		Pipeline:  C.gstreamer_send_create_pipeline(pipelineStrUnsafe),
 		tracks:    tracks,
-		id:        len(pipelines),
+		id:        nextPipelineId,
 		codecName: codecName,
 		clockRate: clockRate,
 	}
@@ -128,10 +177,131 @@ func (p *Pipeline) Start() {
 	C.gstreamer_send_start_pipeline(p.Pipeline, C.int(p.id))
 }
 
+// OnLevel registers a handler for readings from a "level" element in the
+// pipeline. Must be called before Start.
+func (p *Pipeline) OnLevel(fn func(Level)) {
+	p.onLevel = fn
+}
+
+// OnSpectrum registers a handler for band magnitudes (dB) from a
+// "spectrum" element in the pipeline. Must be called before Start.
+func (p *Pipeline) OnSpectrum(fn func([]float32)) {
+	p.onSpectrum = fn
+}
+
+// OnBusMessage registers a handler for errors, warnings, EOS, state changes
+// and latency updates. Must be called before Start.
+func (p *Pipeline) OnBusMessage(fn func(BusMessage)) {
+	p.onBusMessage = fn
+}
+
+// SetOpusEncoder changes the encoder's bitrate and loss resilience while
+// the pipeline is playing
+func (p *Pipeline) SetOpusEncoder(bitrate, packetLossPercentage int, fec bool) error {
+	name := C.CString(OpusEncoderName)
+	defer C.free(unsafe.Pointer(name))
+
+	cFec := C.int(0)
+	if fec {
+		cFec = 1
+	}
+	if C.gstreamer_send_set_opus_encoder(p.Pipeline, name, C.int(bitrate), C.int(packetLossPercentage), cFec) == 0 {
+		return fmt.Errorf("pipeline %d has no %q element", p.id, OpusEncoderName)
+	}
+	return nil
+}
+
+// Recording is a file being written from a pipeline's recording tee
+type Recording struct {
+	id         int
+	pipelineId int
+	handle     *C.PipelineRecording
+	stopOnce   sync.Once
+	doneOnce   sync.Once
+	done       chan struct{}
+}
+
+// nolint
+var (
+	recordings      = make(map[int]*Recording)
+	recordingsLock  sync.Mutex
+	nextRecordingId int
+)
+
+// StartRecording branches the pipeline's audio into a file at path. The
+// pipeline source must end with RecordingElements.
+func (p *Pipeline) StartRecording(format RecordingFormat, path string) (*Recording, error) {
+	description, err := recordingBin(format, path)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptionUnsafe := C.CString(description)
+	defer C.free(unsafe.Pointer(descriptionUnsafe))
+	teeName := C.CString(RecordingTeeName)
+	defer C.free(unsafe.Pointer(teeName))
+
+	recordingsLock.Lock()
+	defer recordingsLock.Unlock()
+
+	nextRecordingId++
+	recording := &Recording{
+		id:         nextRecordingId,
+		pipelineId: p.id,
+		done:       make(chan struct{}),
+	}
+	recording.handle = C.gstreamer_send_start_recording(p.Pipeline, teeName, descriptionUnsafe, C.int(recording.id))
+	if recording.handle == nil {
+		return nil, fmt.Errorf("failed to attach %s recording to pipeline %d", format, p.id)
+	}
+
+	logWithTime("[GST] Recording pipeline %d to %s", p.id, path)
+	recordings[recording.id] = recording
+	return recording, nil
+}
+
+// Stop sends EOS down the recording branch so the file is finalized. Done
+// closes once it has been written out.
+func (r *Recording) Stop() {
+	r.stopOnce.Do(func() {
+		select {
+		case <-r.done:
+			// the pipeline went away first
+		default:
+			C.gstreamer_send_stop_recording(r.handle)
+		}
+	})
+}
+
+// Done is closed once the recording is finalized, or abandoned because its
+// pipeline stopped
+func (r *Recording) Done() <-chan struct{} {
+	return r.done
+}
+
+func (r *Recording) finish() {
+	r.doneOnce.Do(func() { close(r.done) })
+}
+
 // Stop stops the GStreamer Pipeline
 func (p *Pipeline) Stop() {
 	logWithTime("[GST] Stopping pipeline %d", p.id)
+
+	pipelinesLock.Lock()
+	delete(pipelines, p.id)
+	pipelinesLock.Unlock()
+
 	C.gstreamer_send_stop_pipeline(p.Pipeline)
+
+	// anything still recording lost its source without an EOS
+	recordingsLock.Lock()
+	for id, recording := range recordings {
+		if recording.pipelineId == p.id {
+			delete(recordings, id)
+			recording.finish()
+		}
+	}
+	recordingsLock.Unlock()
 }
 
 //export goHandlePipelineBuffer
@@ -151,9 +321,12 @@ func goHandlePipelineBuffer(buffer unsafe.Pointer, bufferLen C.int, duration C.i
 		// }
 
 		for i, t := range pipeline.tracks {
-			if err := t.WriteSample(media.Sample{Data: data, Duration: dur}); err != nil {
+			// a track shared by a room writes to every listener and returns
+			// their errors together, after writing to all of them. A listener
+			// whose connection is closing reports a closed pipe, which is no
+			// reason to stop anyone else's audio.
+			if err := t.WriteSample(media.Sample{Data: data, Duration: dur}); err != nil && !errors.Is(err, io.ErrClosedPipe) {
 				logWithTime("[GST][ERROR] Track %d write failed: %v", i, err)
-				panic(err)
 			}
 		}
 	} else {
@@ -161,3 +334,95 @@ func goHandlePipelineBuffer(buffer unsafe.Pointer, bufferLen C.int, duration C.i
 	}
 	C.free(buffer)
 }
+
+func lookupPipeline(pipelineID C.int) (*Pipeline, bool) {
+	pipelinesLock.Lock()
+	defer pipelinesLock.Unlock()
+	pipeline, ok := pipelines[int(pipelineID)]
+	return pipeline, ok
+}
+
+//export goHandlePipelineLevel
+func goHandlePipelineLevel(rms *C.double, peak *C.double, channels C.int, pipelineID C.int) {
+	pipeline, ok := lookupPipeline(pipelineID)
+	if !ok || pipeline.onLevel == nil || channels <= 0 {
+		return
+	}
+
+	n := int(channels)
+	rmsValues := unsafe.Slice((*float64)(unsafe.Pointer(rms)), n)
+	peakValues := unsafe.Slice((*float64)(unsafe.Pointer(peak)), n)
+
+	// copy out, the C arrays live on the caller's stack
+	pipeline.onLevel(Level{
+		RMS:  append([]float64(nil), rmsValues...),
+		Peak: append([]float64(nil), peakValues...),
+	})
+}
+
+//export goHandlePipelineSpectrum
+func goHandlePipelineSpectrum(magnitudes *C.float, bands C.int, pipelineID C.int) {
+	pipeline, ok := lookupPipeline(pipelineID)
+	if !ok || pipeline.onSpectrum == nil || bands <= 0 {
+		return
+	}
+
+	values := unsafe.Slice((*float32)(unsafe.Pointer(magnitudes)), int(bands))
+	pipeline.onSpectrum(append([]float32(nil), values...))
+}
+
+var busMessageTypes = map[C.int]string{
+	C.PIPELINE_BUS_ERROR:         BusError,
+	C.PIPELINE_BUS_WARNING:       BusWarning,
+	C.PIPELINE_BUS_EOS:           BusEOS,
+	C.PIPELINE_BUS_STATE_CHANGED: BusStateChanged,
+	C.PIPELINE_BUS_LATENCY:       BusLatency,
+}
+
+//export goHandlePipelineBusMessage
+func goHandlePipelineBusMessage(pipelineID C.int, msgType C.int, source *C.char, text *C.char, debug *C.char, oldState C.int, newState C.int) {
+	pipeline, ok := lookupPipeline(pipelineID)
+	if !ok {
+		return
+	}
+
+	msg := BusMessage{
+		Type:    busMessageTypes[msgType],
+		Source:  C.GoString(source),
+		Message: C.GoString(text),
+		Debug:   C.GoString(debug),
+	}
+	if msg.Type == BusStateChanged {
+		msg.OldState = stateName(oldState)
+		msg.NewState = stateName(newState)
+	}
+
+	switch msg.Type {
+	case BusError, BusWarning:
+		logWithTime("[GST][%s] Pipeline %d %s from %s: %s", strings.ToUpper(msg.Type), pipeline.id, msg.Type, msg.Source, msg.Message)
+	case BusEOS:
+		logWithTime("[GST] Pipeline %d reached end of stream", pipeline.id)
+	case BusStateChanged:
+		logWithTime("[GST] Pipeline %d state %s -> %s", pipeline.id, msg.OldState, msg.NewState)
+	}
+
+	if pipeline.onBusMessage != nil {
+		pipeline.onBusMessage(msg)
+	}
+}
+
+func stateName(state C.int) string {
+	return C.GoString((*C.char)(unsafe.Pointer(C.gst_element_state_get_name(C.GstState(state)))))
+}
+
+//export goHandleRecordingFinished
+func goHandleRecordingFinished(recordingID C.int) {
+	recordingsLock.Lock()
+	recording, ok := recordings[int(recordingID)]
+	delete(recordings, int(recordingID))
+	recordingsLock.Unlock()
+
+	if ok {
+		recording.finish()
+	}
+}
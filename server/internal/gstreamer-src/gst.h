@@ -11,10 +11,37 @@
 
 extern void goHandlePipelineBuffer(void *buffer, int bufferLen, int samples,
 				   int pipelineId);
+extern void goHandlePipelineLevel(double *rms, double *peak, int channels,
+				  int pipelineId);
+extern void goHandlePipelineSpectrum(float *magnitudes, int bands,
+				     int pipelineId);
+extern void goHandlePipelineBusMessage(int pipelineId, int type, char *source,
+				       char *text, char *debug, int oldState,
+				       int newState);
+extern void goHandleRecordingFinished(int recordingId);
+
+// bus message types passed to goHandlePipelineBusMessage
+#define PIPELINE_BUS_ERROR 0
+#define PIPELINE_BUS_WARNING 1
+#define PIPELINE_BUS_EOS 2
+#define PIPELINE_BUS_STATE_CHANGED 3
+#define PIPELINE_BUS_LATENCY 4
+
+// level messages carrying more channels than this are truncated
+#define GST_METER_MAX_CHANNELS 8
 
 GstElement *gstreamer_send_create_pipeline(char *pipeline);
 void gstreamer_send_start_pipeline(GstElement *pipeline, int pipelineId);
 void gstreamer_send_stop_pipeline(GstElement *pipeline);
 void gstreamer_send_start_mainloop(void);
+int gstreamer_send_set_opus_encoder(GstElement *pipeline, char *name,
+				    int bitrate, int packetLossPercentage,
+				    int fec);
+
+typedef struct PipelineRecording PipelineRecording;
+PipelineRecording *gstreamer_send_start_recording(GstElement *pipeline,
+					     char *teeName, char *description,
+					     int recordingId);
+void gstreamer_send_stop_recording(PipelineRecording *recording);
 
 #endif
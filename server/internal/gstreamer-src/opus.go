@@ -0,0 +1,57 @@
+package gst
+
+import (
+	"fmt"
+	"strings"
+)
+
+// name of the opusenc element, for changing its properties while playing
+const OpusEncoderName = "encoder"
+
+// OpusOptions configures opusenc
+type OpusOptions struct {
+	// 1 downmixes to mono before encoding, anything else keeps stereo
+	Channels int
+	// target bitrate in bits per second
+	Bitrate int
+	// frame size in milliseconds: 2.5, 5, 10, 20, 40 or 60
+	FrameSize float64
+	// 0-10, higher is better quality for more cpu
+	Complexity int
+	// in-band forward error correction, tuned by PacketLossPercentage
+	FEC                  bool
+	PacketLossPercentage int
+	// discontinuous transmission, stops sending during silence
+	DTX bool
+}
+
+// DefaultOpusOptions matches what CreatePipeline has always used
+func DefaultOpusOptions() OpusOptions {
+	return OpusOptions{
+		Channels:   2,
+		Bitrate:    128000,
+		FrameSize:  20,
+		Complexity: 10,
+	}
+}
+
+// elements returns the encoder stage of a gst-launch description
+func (o OpusOptions) elements() string {
+	var elements []string
+	if o.Channels == 1 {
+		elements = append(elements, "audioconvert", "audio/x-raw,channels=1")
+	}
+
+	encoder := []string{
+		"opusenc",
+		"name=" + OpusEncoderName,
+		fmt.Sprintf("frame-size=%g", o.FrameSize),
+		fmt.Sprintf("complexity=%d", o.Complexity),
+		fmt.Sprintf("bitrate=%d", o.Bitrate),
+		fmt.Sprintf("inband-fec=%t", o.FEC),
+		fmt.Sprintf("packet-loss-percentage=%d", o.PacketLossPercentage),
+		fmt.Sprintf("dtx=%t", o.DTX),
+	}
+	elements = append(elements, strings.Join(encoder, " "))
+	return strings.Join(elements, " ! ")
+}
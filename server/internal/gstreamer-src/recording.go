@@ -0,0 +1,74 @@
+package gst
+
+import "fmt"
+
+// name of the tee the session pipeline exposes for recordings
+const RecordingTeeName = "recordtee"
+
+// RecordingFormat is a container/codec a recording can be written in
+type RecordingFormat string
+
+const (
+	RecordingOgg  RecordingFormat = "ogg"
+	RecordingFLAC RecordingFormat = "flac"
+	RecordingWAV  RecordingFormat = "wav"
+)
+
+// Extension is the file extension for the format, without a dot
+func (f RecordingFormat) Extension() string {
+	if f == RecordingOgg {
+		return "opus"
+	}
+	return string(f)
+}
+
+// ContentType is the mime type served for the format
+func (f RecordingFormat) ContentType() string {
+	switch f {
+	case RecordingOgg:
+		return "audio/ogg"
+	case RecordingFLAC:
+		return "audio/flac"
+	default:
+		return "audio/wav"
+	}
+}
+
+// encoder elements for each format. The ogg branch encodes separately from
+// the stream's encoder, which the bitrate controller keeps changing.
+var recordingEncoders = map[RecordingFormat]string{
+	RecordingOgg:  "audioconvert ! opusenc bitrate=256000 frame-size=20 complexity=10 ! oggmux",
+	RecordingFLAC: "audioconvert ! flacenc",
+	RecordingWAV:  "audioconvert ! wavenc",
+}
+
+// ParseRecordingFormat validates a format name; "" means ogg
+func ParseRecordingFormat(name string) (RecordingFormat, error) {
+	if name == "" {
+		return RecordingOgg, nil
+	}
+	format := RecordingFormat(name)
+	if _, ok := recordingEncoders[format]; !ok {
+		return "", fmt.Errorf("unsupported recording format %q (want ogg, flac or wav)", name)
+	}
+	return format, nil
+}
+
+// recordingBin describes the bin hung off the tee. The sink must be named
+// "sink" so we can tell when EOS has reached the file.
+func recordingBin(format RecordingFormat, path string) (string, error) {
+	encoder, ok := recordingEncoders[format]
+	if !ok {
+		return "", fmt.Errorf("unsupported recording format %q", format)
+	}
+	return fmt.Sprintf("queue ! %s ! filesink name=sink location=%q", encoder, path), nil
+}
+
+// RecordingElements is the tee the pipeline source must end with for
+// StartRecording to work. The queue decouples the stream from file writes.
+func RecordingElements() []string {
+	return []string{
+		fmt.Sprintf("tee name=%s allow-not-linked=true", RecordingTeeName),
+		"queue",
+	}
+}
@@ -0,0 +1,74 @@
+#include "client.h"
+
+// why the callbacks only pass names:
+// - they run on jack's notification thread, so they must stay cheap
+// - names are what the rest of the server matches on anyway
+static void jack_client_port_registration(jack_port_id_t id, int registered, void *arg) {
+  jack_client_t *client = (jack_client_t *)arg;
+  jack_port_t *port = jack_port_by_id(client, id);
+  if (port == NULL) {
+    return;
+  }
+  goJackPortRegistered((char *)jack_port_name(port), registered);
+}
+
+static void jack_client_port_connect(jack_port_id_t a, jack_port_id_t b, int connected, void *arg) {
+  jack_client_t *client = (jack_client_t *)arg;
+  jack_port_t *port_a = jack_port_by_id(client, a);
+  jack_port_t *port_b = jack_port_by_id(client, b);
+  if (port_a == NULL || port_b == NULL) {
+    return;
+  }
+  goJackPortsConnected((char *)jack_port_name(port_a), (char *)jack_port_name(port_b), connected);
+}
+
+static void jack_client_shutdown(void *arg) {
+  goJackShutdown();
+}
+
+jack_client_t *jack_client_open_default(char *name, int *status) {
+  jack_status_t jack_status = 0;
+  jack_client_t *client = jack_client_open(name, JackNoStartServer, &jack_status);
+  *status = (int)jack_status;
+  if (client == NULL) {
+    return NULL;
+  }
+
+  jack_set_port_registration_callback(client, jack_client_port_registration, client);
+  jack_set_port_connect_callback(client, jack_client_port_connect, client);
+  jack_on_shutdown(client, jack_client_shutdown, NULL);
+
+  if (jack_activate(client) != 0) {
+    jack_client_close(client);
+    *status = (int)JackFailure;
+    return NULL;
+  }
+  return client;
+}
+
+const char **jack_client_list_ports(jack_client_t *client) {
+  return jack_get_ports(client, NULL, NULL, 0);
+}
+
+const char **jack_client_port_connections(jack_client_t *client, char *port) {
+  jack_port_t *p = jack_port_by_name(client, port);
+  if (p == NULL) {
+    return NULL;
+  }
+  return jack_port_get_all_connections(client, p);
+}
+
+// returns -1 for unknown ports
+int jack_client_port_flags(jack_client_t *client, char *port) {
+  jack_port_t *p = jack_port_by_name(client, port);
+  if (p == NULL) {
+    return -1;
+  }
+  return jack_port_flags(p);
+}
+
+void jack_client_free_names(const char **names) {
+  if (names != NULL) {
+    jack_free(names);
+  }
+}
@@ -0,0 +1,271 @@
+package jack
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// name the server's own client registers under
+const clientName = "awestruck-server"
+
+var (
+	// ErrClientClosed is returned once the JACK server has gone away; the
+	// next call to Default reconnects
+	ErrClientClosed = errors.New("JACK client closed")
+	// ErrPortTimeout is returned when WaitForPorts gives up
+	ErrPortTimeout = errors.New("timeout waiting for JACK ports")
+)
+
+// why we keep one native client:
+// - spawning jack_lsp every 100ms per session doesn't scale
+// - registration callbacks tell us the moment a port appears
+// - connect/disconnect become function calls instead of processes
+type Client struct {
+	mu     sync.Mutex
+	native *nativeClient
+	graph  *graph
+	// closed and replaced on every graph change to wake waiters
+	changed chan struct{}
+}
+
+var (
+	openMu    sync.Mutex
+	currentMu sync.Mutex
+	current   *Client
+)
+
+// Default returns the shared client, connecting on first use or after
+// the JACK server shut down
+func Default() (*Client, error) {
+	openMu.Lock()
+	defer openMu.Unlock()
+
+	if c := currentClient(); c != nil {
+		return c, nil
+	}
+
+	// registered before opening so callbacks fired during activation land
+	c := &Client{graph: newGraph(), changed: make(chan struct{})}
+	setCurrentClient(c)
+
+	native, err := openNative(clientName)
+	if err != nil {
+		setCurrentClient(nil)
+		return nil, err
+	}
+
+	// seed the graph with whatever existed before we connected
+	ports := native.ports()
+	connections := make(map[string][]string, len(ports))
+	for _, port := range ports {
+		connections[port] = native.connections(port)
+	}
+
+	c.mu.Lock()
+	c.native = native
+	for _, port := range ports {
+		c.graph.addPort(port)
+		for _, peer := range connections[port] {
+			c.graph.connect(port, peer)
+		}
+	}
+	c.notifyLocked()
+	c.mu.Unlock()
+
+	log.Printf("[JACK] Connected to JACK server as %s", clientName)
+	return c, nil
+}
+
+func currentClient() *Client {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	return current
+}
+
+func setCurrentClient(c *Client) {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	current = c
+}
+
+// callers must hold c.mu
+func (c *Client) notifyLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// callers must not hold c.mu: libjack calls block on the server, which
+// may be waiting on our notification thread
+func (c *Client) nativeClient() (*nativeClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.native == nil {
+		return nil, ErrClientClosed
+	}
+	return c.native, nil
+}
+
+// Ports returns every port currently registered with the server
+func (c *Client) Ports() []string {
+	return c.MatchPorts(func(string) bool { return true })
+}
+
+// MatchPorts returns the registered ports that match, sorted by name
+func (c *Client) MatchPorts(match func(port string) bool) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var matched []string
+	for port := range c.graph.ports {
+		if match(port) {
+			matched = append(matched, port)
+		}
+	}
+	sort.Strings(matched)
+	return matched
+}
+
+// SessionPorts returns the ports owned by a session, sorted by name
+func (c *Client) SessionPorts(sessionId string) []Port {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.graph.snapshot(func(port Port) bool { return port.Owner == sessionId }).Ports
+}
+
+// Graph returns a snapshot of every client, port and connection
+func (c *Client) Graph() Graph {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.graph.snapshot(func(Port) bool { return true })
+}
+
+// WaitForPorts blocks until at least one registered port matches and
+// returns all that do
+func (c *Client) WaitForPorts(timeout time.Duration, match func(port string) bool) ([]string, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		c.mu.Lock()
+		if c.native == nil {
+			c.mu.Unlock()
+			return nil, ErrClientClosed
+		}
+		changed := c.changed
+		c.mu.Unlock()
+
+		if matched := c.MatchPorts(match); len(matched) > 0 {
+			return matched, nil
+		}
+
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return nil, ErrPortTimeout
+		}
+	}
+}
+
+// Connections returns the ports connected to port
+func (c *Client) Connections(port string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.native == nil {
+		return nil, ErrClientClosed
+	}
+	return c.graph.peers(port), nil
+}
+
+// Connect connects an output port to an input port. Already connected
+// ports are not an error.
+func (c *Client) Connect(source, destination string) error {
+	native, err := c.nativeClient()
+	if err != nil {
+		return err
+	}
+	return native.connect(source, destination)
+}
+
+// Disconnect removes the connection between two ports, given in either order
+func (c *Client) Disconnect(a, b string) error {
+	native, err := c.nativeClient()
+	if err != nil {
+		return err
+	}
+	if output, ok := native.isOutput(b); ok && output {
+		a, b = b, a
+	}
+	return native.disconnect(a, b)
+}
+
+// Describe lists every port and its connections like jack_lsp -c, noting
+// which session owns each port
+func (c *Client) Describe() string {
+	var b strings.Builder
+	for _, port := range c.Graph().Ports {
+		b.WriteString(port.Name)
+		if port.Owner != "" {
+			fmt.Fprintf(&b, " (session %s)", port.Owner)
+		}
+		b.WriteString("\n")
+		for _, connection := range port.Connections {
+			b.WriteString("   ")
+			b.WriteString(connection)
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// the handlers below run on libjack's notification thread
+
+func handlePortRegistered(port string, registered bool) {
+	c := currentClient()
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if registered {
+		c.graph.addPort(port)
+	} else {
+		c.graph.removePort(port)
+	}
+	c.notifyLocked()
+}
+
+func handlePortsConnected(a, b string, connected bool) {
+	c := currentClient()
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if connected {
+		c.graph.connect(a, b)
+	} else {
+		c.graph.disconnect(a, b)
+	}
+	c.notifyLocked()
+}
+
+func handleShutdown() {
+	c := currentClient()
+	if c == nil {
+		return
+	}
+	log.Printf("[JACK][ERROR] JACK server shut down, client will reconnect on next use")
+
+	setCurrentClient(nil)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.native = nil
+	c.notifyLocked()
+}
@@ -0,0 +1,17 @@
+#ifndef JACK_CLIENT_H
+#define JACK_CLIENT_H
+
+#include <jack/jack.h>
+#include <stdlib.h>
+
+extern void goJackPortRegistered(char *name, int registered);
+extern void goJackPortsConnected(char *a, char *b, int connected);
+extern void goJackShutdown(void);
+
+jack_client_t *jack_client_open_default(char *name, int *status);
+const char **jack_client_list_ports(jack_client_t *client);
+const char **jack_client_port_connections(jack_client_t *client, char *port);
+int jack_client_port_flags(jack_client_t *client, char *port);
+void jack_client_free_names(const char **names);
+
+#endif
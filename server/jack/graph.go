@@ -0,0 +1,115 @@
+package jack
+
+import "sort"
+
+// Port is one JACK port as seen by the registry
+type Port struct {
+	Name        string   `json:"name"`
+	Client      string   `json:"client"`
+	Short       string   `json:"short"`
+	Owner       string   `json:"owner,omitempty"`
+	Connections []string `json:"connections,omitempty"`
+}
+
+// ClientPorts groups a JACK client's ports
+type ClientPorts struct {
+	Name  string   `json:"name"`
+	Owner string   `json:"owner,omitempty"`
+	Ports []string `json:"ports"`
+}
+
+// Graph is a point-in-time copy of the port graph
+type Graph struct {
+	Clients []ClientPorts `json:"clients"`
+	Ports   []Port        `json:"ports"`
+}
+
+// graph mirrors the server's ports and connections from registration and
+// connect callbacks. Guarded by the owning Client's mu.
+type graph struct {
+	ports map[string]bool
+	// undirected; each connection is stored under both ports
+	edges map[string]map[string]bool
+}
+
+func newGraph() *graph {
+	return &graph{
+		ports: make(map[string]bool),
+		edges: make(map[string]map[string]bool),
+	}
+}
+
+func (g *graph) addPort(port string) {
+	g.ports[port] = true
+}
+
+// an unregistered port takes its connections with it
+func (g *graph) removePort(port string) {
+	for peer := range g.edges[port] {
+		delete(g.edges[peer], port)
+	}
+	delete(g.edges, port)
+	delete(g.ports, port)
+}
+
+func (g *graph) connect(a, b string) {
+	g.link(a, b)
+	g.link(b, a)
+}
+
+func (g *graph) link(from, to string) {
+	if g.edges[from] == nil {
+		g.edges[from] = make(map[string]bool)
+	}
+	g.edges[from][to] = true
+}
+
+func (g *graph) disconnect(a, b string) {
+	delete(g.edges[a], b)
+	delete(g.edges[b], a)
+}
+
+func (g *graph) peers(port string) []string {
+	peers := make([]string, 0, len(g.edges[port]))
+	for peer := range g.edges[port] {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// snapshot copies the ports that match, with owners resolved now so a
+// later claim is reflected without touching the graph
+func (g *graph) snapshot(match func(Port) bool) Graph {
+	names := make([]string, 0, len(g.ports))
+	for name := range g.ports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var snapshot Graph
+	clients := make(map[string]int)
+	for _, name := range names {
+		client, short, _ := SplitPortName(name)
+		port := Port{
+			Name:        name,
+			Client:      client,
+			Short:       short,
+			Owner:       OwnerOf(name),
+			Connections: g.peers(name),
+		}
+		if !match(port) {
+			continue
+		}
+		snapshot.Ports = append(snapshot.Ports, port)
+
+		i, ok := clients[client]
+		if !ok {
+			i = len(snapshot.Clients)
+			clients[client] = i
+			snapshot.Clients = append(snapshot.Clients, ClientPorts{Name: client, Owner: clientOwner(client)})
+		}
+		snapshot.Clients[i].Ports = append(snapshot.Clients[i].Ports, name)
+	}
+	return snapshot
+}
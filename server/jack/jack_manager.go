@@ -1,63 +1,38 @@
 package jack
 
 import (
+	"encoding/json"
 	"fmt"
-	"os/exec"
+	"net/http"
 	"strings"
+	"time"
+
+	"github.com/po-studio/server/config"
 )
 
-func DisconnectJackPorts(appSessionId string, jackClientName string) error {
-	// Get all current connections
-	cmd := exec.Command("jack_lsp", "-c")
-	output, err := cmd.CombinedOutput()
+// DisconnectSession removes every connection touching a port the session
+// owns, leaving other sessions' ports alone
+func DisconnectSession(appSessionId string) error {
+	client, err := Default()
 	if err != nil {
 		return fmt.Errorf("error getting JACK connections: %w", err)
 	}
 
 	// Track unique connections to avoid duplicates
 	seenConnections := make(map[string]bool)
-	connections := strings.Split(string(output), "\n")
-	var currentPort string
-	var currentConnections []string
 	var disconnectErrors []string
 
-	for _, line := range connections {
-		if line == "" {
-			continue
-		}
-
-		if !strings.HasPrefix(line, "   ") {
-			// Handle previous port's connections
-			if len(currentConnections) > 0 {
-				for _, conn := range currentConnections {
-					// Create unique connection identifier
-					connKey := fmt.Sprintf("%s->%s", currentPort, conn)
-					reverseKey := fmt.Sprintf("%s->%s", conn, currentPort)
-
-					if !seenConnections[connKey] && !seenConnections[reverseKey] {
-						seenConnections[connKey] = true
-						disconnectErrors = append(disconnectErrors,
-							disconnectPortConnections(currentPort, []string{conn}, appSessionId, jackClientName)...)
-					}
-				}
+	for _, port := range client.SessionPorts(appSessionId) {
+		for _, conn := range port.Connections {
+			connKey := fmt.Sprintf("%s->%s", port.Name, conn)
+			reverseKey := fmt.Sprintf("%s->%s", conn, port.Name)
+			if seenConnections[connKey] || seenConnections[reverseKey] {
+				continue
 			}
-			currentPort = strings.TrimSpace(line)
-			currentConnections = nil
-		} else {
-			currentConnections = append(currentConnections, strings.TrimSpace(line))
-		}
-	}
+			seenConnections[connKey] = true
 
-	// Handle the last port's connections
-	if len(currentConnections) > 0 {
-		for _, conn := range currentConnections {
-			connKey := fmt.Sprintf("%s->%s", currentPort, conn)
-			reverseKey := fmt.Sprintf("%s->%s", conn, currentPort)
-
-			if !seenConnections[connKey] && !seenConnections[reverseKey] {
-				seenConnections[connKey] = true
-				disconnectErrors = append(disconnectErrors,
-					disconnectPortConnections(currentPort, []string{conn}, appSessionId, jackClientName)...)
+			if err := client.Disconnect(port.Name, conn); err != nil {
+				disconnectErrors = append(disconnectErrors, err.Error())
 			}
 		}
 	}
@@ -68,43 +43,57 @@ func DisconnectJackPorts(appSessionId string, jackClientName string) error {
 	return nil
 }
 
-func disconnectPortConnections(port string, connections []string, appSessionId string, jackClientName string) []string {
-	var errors []string
-
-	// Check if this port needs to be cleaned up
-	isWebRTCPort := strings.Contains(port, "webrtc-server") && strings.Contains(port, fmt.Sprintf("in_%s", appSessionId))
-	isSuperColliderPort := strings.HasPrefix(port, jackClientName) && strings.Contains(jackClientName, appSessionId)
+// isSourcePortOf reports whether port is a jackaudiosrc input owned by the session
+func isSourcePortOf(port string, appSessionId string) bool {
+	_, short, ok := SplitPortName(port)
+	if !ok {
+		return false
+	}
+	if _, _, ok := ParseSourcePort(short); !ok {
+		return false
+	}
+	return OwnerOf(port) == appSessionId
+}
 
-	if isWebRTCPort || isSuperColliderPort {
-		for _, connectedPort := range connections {
-			cmd := exec.Command("jack_disconnect", connectedPort, port)
-			if err := cmd.Run(); err != nil {
-				errors = append(errors, fmt.Errorf("failed to disconnect %s from %s: %w", connectedPort, port, err).Error())
-			}
-		}
+func GetGStreamerJackPorts(appSessionId string) ([]string, error) {
+	client, err := Default()
+	if err != nil {
+		return nil, fmt.Errorf("error listing JACK ports: %w", err)
 	}
 
-	return errors
+	return client.MatchPorts(func(port string) bool {
+		return isSourcePortOf(port, appSessionId)
+	}), nil
 }
 
-func GetGStreamerJackPorts(appSessionId string) ([]string, error) {
-	cmd := exec.Command("jack_lsp")
-	var out strings.Builder
-	cmd.Stdout = &out
-	err := cmd.Run()
+// WaitForGStreamerJackPorts blocks until the session's jackaudiosrc has
+// registered its input ports. The source must have been claimed first.
+func WaitForGStreamerJackPorts(appSessionId string, timeout time.Duration) ([]string, error) {
+	client, err := Default()
 	if err != nil {
 		return nil, fmt.Errorf("error listing JACK ports: %w", err)
 	}
 
-	ports := strings.Split(out.String(), "\n")
-	var gstJackPorts []string
-	prefix := "webrtc-server"
+	return client.WaitForPorts(timeout, func(port string) bool {
+		return isSourcePortOf(port, appSessionId)
+	})
+}
 
-	for _, port := range ports {
-		if strings.HasPrefix(port, prefix) && strings.Contains(port, appSessionId) {
-			gstJackPorts = append(gstJackPorts, port)
-		}
+// HandleGraph dumps the port graph with session ownership, for debugging
+// stuck or crossed connections
+func HandleGraph(w http.ResponseWriter, r *http.Request) {
+	apiKey := r.Header.Get("Awestruck-API-Key")
+	if apiKey == "" || !config.ValidateAwestruckAPIKey(apiKey) {
+		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		return
+	}
+
+	client, err := Default()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
 	}
 
-	return gstJackPorts, nil
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(client.Graph())
 }
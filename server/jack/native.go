@@ -0,0 +1,107 @@
+package jack
+
+/*
+#cgo pkg-config: jack
+
+#include "client.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// nativeClient is the libjack connection behind a Client
+type nativeClient struct {
+	handle *C.jack_client_t
+}
+
+func openNative(name string) (*nativeClient, error) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	var status C.int
+	handle := C.jack_client_open_default(cName, &status)
+	if handle == nil {
+		return nil, fmt.Errorf("failed to open JACK client %q (status 0x%x)", name, int(status))
+	}
+	return &nativeClient{handle: handle}, nil
+}
+
+func (n *nativeClient) ports() []string {
+	return goNames(C.jack_client_list_ports(n.handle))
+}
+
+func (n *nativeClient) connections(port string) []string {
+	cPort := C.CString(port)
+	defer C.free(unsafe.Pointer(cPort))
+	return goNames(C.jack_client_port_connections(n.handle, cPort))
+}
+
+// isOutput reports whether port is an output; ok is false for unknown ports
+func (n *nativeClient) isOutput(port string) (output bool, ok bool) {
+	cPort := C.CString(port)
+	defer C.free(unsafe.Pointer(cPort))
+
+	flags := C.jack_client_port_flags(n.handle, cPort)
+	if flags < 0 {
+		return false, false
+	}
+	return int(flags)&int(C.JackPortIsOutput) != 0, true
+}
+
+func (n *nativeClient) connect(source, destination string) error {
+	cSource := C.CString(source)
+	defer C.free(unsafe.Pointer(cSource))
+	cDestination := C.CString(destination)
+	defer C.free(unsafe.Pointer(cDestination))
+
+	// EEXIST just means someone got there first
+	if rc := C.jack_connect(n.handle, cSource, cDestination); rc != 0 && syscall.Errno(rc) != syscall.EEXIST {
+		return fmt.Errorf("failed to connect %s to %s: jack error %d", source, destination, int(rc))
+	}
+	return nil
+}
+
+func (n *nativeClient) disconnect(source, destination string) error {
+	cSource := C.CString(source)
+	defer C.free(unsafe.Pointer(cSource))
+	cDestination := C.CString(destination)
+	defer C.free(unsafe.Pointer(cDestination))
+
+	if rc := C.jack_disconnect(n.handle, cSource, cDestination); rc != 0 {
+		return fmt.Errorf("failed to disconnect %s from %s: jack error %d", source, destination, int(rc))
+	}
+	return nil
+}
+
+// goNames copies and frees a NULL-terminated array from libjack
+func goNames(names **C.char) []string {
+	if names == nil {
+		return nil
+	}
+	defer C.jack_client_free_names(names)
+
+	var result []string
+	for p := names; *p != nil; p = (**C.char)(unsafe.Pointer(uintptr(unsafe.Pointer(p)) + unsafe.Sizeof(*p))) {
+		result = append(result, C.GoString(*p))
+	}
+	return result
+}
+
+//export goJackPortRegistered
+func goJackPortRegistered(name *C.char, registered C.int) {
+	handlePortRegistered(C.GoString(name), registered != 0)
+}
+
+//export goJackPortsConnected
+func goJackPortsConnected(a *C.char, b *C.char, connected C.int) {
+	handlePortsConnected(C.GoString(a), C.GoString(b), connected != 0)
+}
+
+//export goJackShutdown
+func goJackShutdown() {
+	handleShutdown()
+}
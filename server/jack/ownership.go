@@ -0,0 +1,123 @@
+package jack
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// why ownership is explicit:
+//   - substring matching mis-assigns ports when one session id prefixes another
+//   - scsynth picks its own client name, so only the session that launched it
+//     knows which client is whose
+//   - claims outlive reconnects to the JACK server
+var ownership = struct {
+	sync.Mutex
+	// JACK client name -> session id, e.g. a session's scsynth
+	clients map[string]string
+	// jackaudiosrc element name -> session id
+	sources map[string]string
+}{
+	clients: make(map[string]string),
+	sources: make(map[string]string),
+}
+
+// ClaimClient records that every port of a JACK client belongs to a session
+func ClaimClient(sessionId, clientName string) {
+	ownership.Lock()
+	defer ownership.Unlock()
+	ownership.clients[clientName] = sessionId
+}
+
+// ReleaseClient drops the claim on a client, e.g. once its process exits
+// and the name may be handed to someone else
+func ReleaseClient(clientName string) {
+	ownership.Lock()
+	defer ownership.Unlock()
+	delete(ownership.clients, clientName)
+}
+
+// ClaimSource records that the input ports of a jackaudiosrc element belong
+// to a session. jackaudiosrc registers them as in_<element>_<n> on the
+// server's own client.
+func ClaimSource(sessionId, elementName string) {
+	ownership.Lock()
+	defer ownership.Unlock()
+	ownership.sources[elementName] = sessionId
+}
+
+// ReleaseSession drops every claim held by a session
+func ReleaseSession(sessionId string) {
+	ownership.Lock()
+	defer ownership.Unlock()
+	for name, owner := range ownership.clients {
+		if owner == sessionId {
+			delete(ownership.clients, name)
+		}
+	}
+	for name, owner := range ownership.sources {
+		if owner == sessionId {
+			delete(ownership.sources, name)
+		}
+	}
+}
+
+// OwnerOf returns the session owning a full port name, or "" if unclaimed
+func OwnerOf(port string) string {
+	client, short, ok := SplitPortName(port)
+	if !ok {
+		return ""
+	}
+
+	ownership.Lock()
+	defer ownership.Unlock()
+
+	if owner, ok := ownership.clients[client]; ok {
+		return owner
+	}
+	if element, _, ok := ParseSourcePort(short); ok {
+		return ownership.sources[element]
+	}
+	return ""
+}
+
+// clientOwner returns the session that claimed a whole client, if any
+func clientOwner(client string) string {
+	ownership.Lock()
+	defer ownership.Unlock()
+	return ownership.clients[client]
+}
+
+// SplitPortName splits "client:port" at the first colon. JACK forbids
+// colons in client names, so the port part may still contain them.
+func SplitPortName(port string) (client, short string, ok bool) {
+	client, short, ok = strings.Cut(port, ":")
+	if !ok || client == "" || short == "" {
+		return "", "", false
+	}
+	return client, short, true
+}
+
+// ParseSourcePort parses a jackaudiosrc port name, in_<element>_<n>, into
+// the element name and 1-based channel
+func ParseSourcePort(short string) (element string, channel int, ok bool) {
+	if !strings.HasPrefix(short, "in_") {
+		return "", 0, false
+	}
+	rest := strings.TrimPrefix(short, "in_")
+	sep := strings.LastIndex(rest, "_")
+	if sep <= 0 {
+		return "", 0, false
+	}
+	channel, err := strconv.Atoi(rest[sep+1:])
+	if err != nil || channel < 1 {
+		return "", 0, false
+	}
+	return rest[:sep], channel, true
+}
+
+// SourcePortName is the inverse of ParseSourcePort
+func SourcePortName(element string, channel int) string {
+	return fmt.Sprintf("in_%s_%d", element, channel)
+}
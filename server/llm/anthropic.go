@@ -0,0 +1,140 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultAnthropicBaseURL = "https://api.anthropic.com"
+	defaultAnthropicModel   = "claude-sonnet-4-5"
+	anthropicVersion        = "2023-06-01"
+	// the messages api requires max_tokens on every request
+	defaultAnthropicMaxTokens = 16000
+)
+
+// AnthropicProvider talks to the Anthropic Messages api over plain http;
+// the request is small enough that an sdk would only add dependencies
+type AnthropicProvider struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+// NewAnthropicProvider returns a provider for the Messages api. An empty
+// baseURL means api.anthropic.com.
+func NewAnthropicProvider(apiKey, baseURL string) *AnthropicProvider {
+	if baseURL == "" {
+		baseURL = defaultAnthropicBaseURL
+	}
+	return &AnthropicProvider{
+		apiKey:  apiKey,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{},
+	}
+}
+
+func (p *AnthropicProvider) Name() string         { return ProviderAnthropic }
+func (p *AnthropicProvider) DefaultModel() string { return defaultAnthropicModel }
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model     string             `json:"model"`
+	MaxTokens int                `json:"max_tokens"`
+	Messages  []anthropicMessage `json:"messages"`
+}
+
+type anthropicResponse struct {
+	Model   string `json:"model"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *AnthropicProvider) Complete(ctx context.Context, req Request) (*Response, error) {
+	body := anthropicRequest{
+		Model:     req.Model,
+		MaxTokens: req.MaxTokens,
+	}
+	for _, msg := range req.Messages {
+		body.Messages = append(body.Messages, anthropicMessage{Role: msg.Role, Content: msg.Content})
+	}
+	if body.Model == "" {
+		body.Model = defaultAnthropicModel
+	}
+	if body.MaxTokens <= 0 {
+		body.MaxTokens = defaultAnthropicMaxTokens
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/v1/messages", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-Api-Key", p.apiKey)
+	httpReq.Header.Set("Anthropic-Version", anthropicVersion)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("anthropic API error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("anthropic API error: %v", err)
+	}
+
+	var result anthropicResponse
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("anthropic API error: status %d: %.200s", resp.StatusCode, raw)
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("anthropic API error: status %d: %s: %s", resp.StatusCode, result.Error.Type, result.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("anthropic API error: status %d", resp.StatusCode)
+	}
+
+	var text strings.Builder
+	for _, block := range result.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return nil, fmt.Errorf("no response from anthropic (stop reason %q)", result.StopReason)
+	}
+
+	return &Response{
+		Text:  text.String(),
+		Model: result.Model,
+		Usage: Usage{
+			InputTokens:  result.Usage.InputTokens,
+			OutputTokens: result.Usage.OutputTokens,
+		},
+	}, nil
+}
@@ -0,0 +1,133 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newAnthropicStub(t *testing.T, handler http.HandlerFunc) *AnthropicProvider {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return NewAnthropicProvider("test-key", server.URL)
+}
+
+func TestAnthropicComplete(t *testing.T) {
+	// the handler runs on the server's goroutine, so it only records what
+	// it got; the assertions happen back on the test's
+	var (
+		path, apiKey, version string
+		body                  anthropicRequest
+	)
+	provider := newAnthropicStub(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		apiKey = r.Header.Get("X-Api-Key")
+		version = r.Header.Get("Anthropic-Version")
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Write([]byte(`{
+			"model": "claude-test",
+			"content": [
+				{"type": "thinking", "text": "ignored"},
+				{"type": "text", "text": "var sound = "},
+				{"type": "text", "text": "SinOsc.ar;"}
+			],
+			"stop_reason": "end_turn",
+			"usage": {"input_tokens": 12, "output_tokens": 34}
+		}`))
+	})
+
+	resp, err := provider.Complete(context.Background(), Request{
+		Messages: []Message{
+			{Role: RoleUser, Content: "write a synth"},
+			{Role: RoleAssistant, Content: "ok"},
+		},
+		MaxTokens: 100,
+	})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+
+	if path != "/v1/messages" {
+		t.Errorf("path = %q, want /v1/messages", path)
+	}
+	if apiKey != "test-key" {
+		t.Errorf("X-Api-Key = %q, want test-key", apiKey)
+	}
+	if version != anthropicVersion {
+		t.Errorf("Anthropic-Version = %q, want %q", version, anthropicVersion)
+	}
+	if body.Model != defaultAnthropicModel {
+		t.Errorf("model = %q, want the default %q", body.Model, defaultAnthropicModel)
+	}
+	if body.MaxTokens != 100 {
+		t.Errorf("max_tokens = %d, want 100", body.MaxTokens)
+	}
+	if len(body.Messages) != 2 || body.Messages[1].Role != RoleAssistant {
+		t.Errorf("messages = %+v, want user then assistant", body.Messages)
+	}
+
+	if resp.Text != "var sound = SinOsc.ar;" {
+		t.Errorf("text = %q", resp.Text)
+	}
+	if resp.Model != "claude-test" {
+		t.Errorf("model = %q, want claude-test", resp.Model)
+	}
+	if resp.Usage != (Usage{InputTokens: 12, OutputTokens: 34}) {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestAnthropicCompleteErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{
+			name:    "error body",
+			status:  http.StatusTooManyRequests,
+			body:    `{"type": "error", "error": {"type": "rate_limit_error", "message": "slow down"}}`,
+			wantErr: "status 429: rate_limit_error: slow down",
+		},
+		{
+			name:    "non-json error",
+			status:  http.StatusBadGateway,
+			body:    "<html>bad gateway</html>",
+			wantErr: "status 502: <html>bad gateway</html>",
+		},
+		{
+			name:    "empty content",
+			status:  http.StatusOK,
+			body:    `{"model": "claude-test", "content": [], "stop_reason": "max_tokens"}`,
+			wantErr: `no response from anthropic (stop reason "max_tokens")`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newAnthropicStub(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+
+			resp, err := provider.Complete(context.Background(), Request{
+				Messages: []Message{{Role: RoleUser, Content: "write a synth"}},
+			})
+			if err == nil {
+				t.Fatalf("Complete returned %+v, want an error", resp)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,6 +2,9 @@ package llm
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -9,50 +12,175 @@ import (
 
 	"github.com/po-studio/server/config"
 	sc "github.com/po-studio/server/supercollider"
-	openai "github.com/sashabaranov/go-openai"
 )
 
-func GenerateSynthCode(provider, prompt, model string) (string, error) {
-	var llmResponse string
-	var err error
+// how much a model may write; the prompt asks for ~300 lines
+const maxSynthTokens = 20000
 
-	log.Printf("[SYNTH-GEN] Starting synth generation with provider=%s, model=%s", provider, model)
+// reasoning models can think for minutes before answering
+const generationTimeout = 10 * time.Minute
 
-	if provider == "" {
-		provider = "openai"
-		log.Printf("[SYNTH-GEN] No provider specified, defaulting to %s", provider)
-	}
+// GenerationAttempt is one round of writing code and handing it to sclang
+type GenerationAttempt struct {
+	Attempt int    `json:"attempt"`
+	Code    string `json:"code"`
+	// sclang's diagnostics when it rejected the code
+	Error string `json:"error,omitempty"`
+	Usage Usage  `json:"usage"`
+}
 
-	switch provider {
-	case "openai":
-		log.Printf("[SYNTH-GEN] Generating synth code with OpenAI")
-		llmResponse, err = generateWithOpenAI(prompt, model)
+// GeneratedSynth is a synthdef written by a model and saved to the
+// generated catalog under Id
+type GeneratedSynth struct {
+	Id       string `json:"id"`
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	// empty until sclang accepts an attempt
+	Code     string              `json:"code"`
+	Usage    Usage               `json:"usage"`
+	Attempts []GenerationAttempt `json:"attempts"`
+}
+
+// ProgressFunc hears about each stage of a generation; state is one of the
+// job states
+type ProgressFunc func(state, message string)
+
+// why generation is a compile-and-repair loop:
+// - most rejected code is a syntax slip or a variable declared twice
+// - the model fixes those in one more turn when shown sclang's error
+// - starting over would throw away an otherwise good patch
+//
+// progress may be nil. On failure the returned synth, when not nil, holds
+// the attempts made and tokens spent so far.
+func GenerateSynthCode(providerName, prompt, model string, progress ProgressFunc) (*GeneratedSynth, error) {
+	if progress == nil {
+		progress = func(string, string) {}
 	}
+	log.Printf("[SYNTH-GEN] Starting synth generation with provider=%s, model=%s", providerName, model)
 
+	provider, err := GetProvider(providerName)
 	if err != nil {
-		log.Printf("[SYNTH-GEN][ERROR] Failed to generate synth code: %v", err)
-		return "", err
+		log.Printf("[SYNTH-GEN][ERROR] %v", err)
+		return nil, err
+	}
+	if model == "" {
+		model = provider.DefaultModel()
+		log.Printf("[SYNTH-GEN] No model specified, defaulting to %s", model)
 	}
 
-	// Generate unique ID for the synth
-	id := fmt.Sprintf("%s-%s-%s", provider, model, formatTimestamp())
+	// Generate unique ID for the synth; every attempt compiles under it.
+	// Workers run side by side, so the timestamp alone can repeat.
+	modelDir := safeIdPart(model)
+	id := fmt.Sprintf("%s-%s-%s-%s", provider.Name(), modelDir, formatTimestamp(), randomIdSuffix())
 	log.Printf("[SYNTH-GEN] Generated synth ID: %s", id)
 
-	// Save the synthdef
-	log.Printf("[SYNTH-GEN] Saving synthdef with ID=%s", id)
-	if err := sc.SaveSynthDef(id, provider, model, llmResponse); err != nil {
-		log.Printf("[SYNTH-GEN][ERROR] Failed to save synthdef: %v", err)
-		return "", fmt.Errorf("failed to save synthdef: %v", err)
+	generated := &GeneratedSynth{Id: id, Provider: provider.Name(), Model: model}
+	messages := []Message{{Role: RoleUser, Content: buildSynthPrompt(prompt)}}
+	maxAttempts := MaxGenerationAttempts()
+
+	var compileErr *sc.CompileError
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		log.Printf("[SYNTH-GEN] Attempt %d/%d with %s", attempt, maxAttempts, provider.Name())
+		progress(JobGenerating, fmt.Sprintf("attempt %d/%d: asking %s for code with %s", attempt, maxAttempts, provider.Name(), model))
+		resp, err := completeSynth(provider, model, messages)
+		if err != nil {
+			log.Printf("[SYNTH-GEN][ERROR] Failed to generate synth code: %v", err)
+			saveGenerationLog(generated)
+			return generated, err
+		}
+		log.Printf("[SYNTH-GEN] %s/%s used %d input and %d output tokens",
+			provider.Name(), resp.Model, resp.Usage.InputTokens, resp.Usage.OutputTokens)
+		generated.Usage.InputTokens += resp.Usage.InputTokens
+		generated.Usage.OutputTokens += resp.Usage.OutputTokens
+
+		code := cleanSynthCode(resp.Text)
+		record := GenerationAttempt{Attempt: attempt, Code: code, Usage: resp.Usage}
+		if code == "" {
+			record.Error = "no code in the response"
+			generated.Attempts = append(generated.Attempts, record)
+			saveGenerationLog(generated)
+			return generated, fmt.Errorf("%s returned no code", provider.Name())
+		}
+		log.Printf("[SYNTH-GEN] Generated code (cleaned):\n%s", code)
+
+		log.Printf("[SYNTH-GEN] Saving synthdef with ID=%s", id)
+		progress(JobCompiling, fmt.Sprintf("attempt %d/%d: compiling %d lines with sclang", attempt, maxAttempts, strings.Count(code, "\n")+1))
+		err = sc.SaveSynthDef(id, provider.Name(), modelDir, code)
+		if err == nil {
+			generated.Code = code
+			generated.Attempts = append(generated.Attempts, record)
+			saveGenerationLog(generated)
+			log.Printf("[SYNTH-GEN] Successfully saved synthdef after %d attempts", attempt)
+			return generated, nil
+		}
+
+		// only sclang's complaints are worth a retry
+		if !errors.As(err, &compileErr) {
+			log.Printf("[SYNTH-GEN][ERROR] Failed to save synthdef: %v", err)
+			record.Error = err.Error()
+			generated.Attempts = append(generated.Attempts, record)
+			saveGenerationLog(generated)
+			return generated, fmt.Errorf("failed to save synthdef: %v", err)
+		}
+
+		log.Printf("[SYNTH-GEN] sclang rejected attempt %d:\n%s", attempt, compileErr.Output)
+		progress(JobCompiling, fmt.Sprintf("attempt %d/%d: sclang rejected the code:\n%s", attempt, maxAttempts, compileErr.Output))
+		record.Error = compileErr.Output
+		generated.Attempts = append(generated.Attempts, record)
+		messages = append(messages,
+			Message{Role: RoleAssistant, Content: resp.Text},
+			Message{Role: RoleUser, Content: buildRepairPrompt(compileErr.Output)},
+		)
 	}
-	log.Printf("[SYNTH-GEN] Successfully saved synthdef")
 
-	return llmResponse, nil
+	saveGenerationLog(generated)
+	return generated, fmt.Errorf("sclang rejected all %d attempts: %w", maxAttempts, compileErr)
+}
+
+// MaxGenerationAttempts is how many completions one generation may make:
+// the first plus SYNTH_REPAIR_ATTEMPTS follow-ups
+func MaxGenerationAttempts() int {
+	if cfg, ok := config.Lookup(); ok {
+		return 1 + cfg.SynthRepairAttempts
+	}
+	return 1 + config.DefaultSynthRepairAttempts
 }
 
-func generateWithOpenAI(userPrompt, model string) (string, error) {
-	log.Printf("[OPENAI] Starting OpenAI code generation with model=%s", model)
-	key := config.Get().OpenAIAPIKey
+// MaxGenerationOutputTokens is the most output one generation may be billed
+// for. Input isn't capped, but the prompt and sclang's errors stay small
+// next to the code the model writes.
+func MaxGenerationOutputTokens() int {
+	return MaxGenerationAttempts() * maxSynthTokens
+}
+
+func completeSynth(provider Provider, model string, messages []Message) (*Response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), generationTimeout)
+	defer cancel()
+	return provider.Complete(ctx, Request{
+		Model:     model,
+		Messages:  messages,
+		MaxTokens: maxSynthTokens,
+	})
+}
+
+func saveGenerationLog(generated *GeneratedSynth) {
+	if err := sc.SaveGenerationLog(generated.Id, generated.Provider, safeIdPart(generated.Model), generated); err != nil {
+		log.Printf("[SYNTH-GEN][ERROR] Failed to record attempts for %s: %v", generated.Id, err)
+	}
+}
+
+// buildRepairPrompt asks for a corrected version of the previous reply
+func buildRepairPrompt(compilerOutput string) string {
+	return fmt.Sprintf(`SuperCollider rejected that code with:
+
+%s
 
+Fix these errors and return the complete corrected code that replaces // YOUR CODE HERE.
+Keep every variable declared exactly once, at the start, and the final signal in 'sound'.
+Return ONLY the raw SuperCollider code.`, compilerOutput)
+}
+
+func buildSynthPrompt(userPrompt string) string {
 	if userPrompt == "" {
 		userPrompt = `
 		Generate a single SuperCollider SynthDef that creates a continuously evolving, musical ambient environment, rather than just sound effects. 
@@ -60,7 +188,7 @@ func generateWithOpenAI(userPrompt, model string) (string, error) {
 		`
 	}
 
-	mainPrompt := fmt.Sprintf(`	
+	return fmt.Sprintf(`	
 	USER PROMPT START
 	%s
 	USER PROMPT END
@@ -89,47 +217,37 @@ func generateWithOpenAI(userPrompt, model string) (string, error) {
 	
 	Return ONLY the raw SuperCollider code that replaces // YOUR CODE HERE.
 	`, userPrompt)
+}
 
-	// hardcode to O1Preview for now
-	if model == "" {
-		model = openai.O1Preview
-	}
-
-	client := openai.NewClient(key)
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: model,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: mainPrompt,
-				},
-			},
-			MaxCompletionTokens: 20000,
-		},
-	)
-
-	if err != nil {
-		return "", fmt.Errorf("OpenAI API error: %v", err)
-	}
-
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no response from OpenAI")
-	}
-
-	// Clean the response by removing markdown code block markers
-	content := resp.Choices[0].Message.Content
+// cleanSynthCode strips the markdown code fences models like to add
+func cleanSynthCode(content string) string {
+	content = strings.TrimSpace(content)
 	content = strings.TrimPrefix(content, "```supercollider")
 	content = strings.TrimPrefix(content, "```scd")
 	content = strings.TrimPrefix(content, "```")
 	content = strings.TrimSuffix(content, "```")
-	content = strings.TrimSpace(content)
+	return strings.TrimSpace(content)
+}
 
-	log.Printf("[OPENAI] Generated code (cleaned):\n%s", content)
-	return content, nil
+// safeIdPart keeps model names like "qwen2.5-coder:7b" or "org/model"
+// usable in synthdef ids and file paths
+func safeIdPart(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '-'
+		}
+	}, s)
 }
 
 func formatTimestamp() string {
 	return time.Now().Format("2006_01_02_15_04_05")
 }
+
+func randomIdSuffix() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,290 @@
+package llm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/po-studio/server/config"
+	"github.com/po-studio/server/quality"
+	sc "github.com/po-studio/server/supercollider"
+)
+
+// job states, in the order a generation moves through them
+const (
+	JobQueued     = "queued"
+	JobGenerating = "generating"
+	JobCompiling  = "compiling"
+	// rendering offline for the quality gate
+	JobChecking = "checking"
+	JobFailed   = "failed"
+	// compiled but failed the quality gate, so it won't be served
+	JobQuarantined = "quarantined"
+	// passed the gate and was added to the synthdef library
+	JobReady = "ready"
+)
+
+const (
+	// generations waiting for a worker before Submit turns new ones away
+	maxQueuedJobs = 32
+	// finished jobs are forgotten after this so polling has time to see them
+	jobRetention = 24 * time.Hour
+	// a repair loop logs a few lines per attempt, so this only caps runaways
+	maxJobLogEntries = 200
+)
+
+var (
+	ErrUnknownJob   = errors.New("generation job not found")
+	ErrJobQueueFull = errors.New("too many synth generations queued, try again later")
+)
+
+// GenerationRequest describes a synth to generate
+type GenerationRequest struct {
+	Prompt string `json:"prompt"`
+	// empty means DefaultProvider
+	Provider string `json:"provider"`
+	// empty means the provider's default model
+	Model string `json:"model"`
+}
+
+// JobLogEntry is one line of a job's progress
+type JobLogEntry struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// Job is a synth generation and its outcome
+type Job struct {
+	Id      string            `json:"id"`
+	Request GenerationRequest `json:"request"`
+	State   string            `json:"state"`
+	// the saved synthdef's name, once compiled
+	SynthDef string `json:"synthdef,omitempty"`
+	Code     string `json:"code,omitempty"`
+	Model    string `json:"model,omitempty"`
+	Usage    *Usage `json:"usage,omitempty"`
+	Attempts int    `json:"attempts,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// the quality gate's measurements, once checked
+	Quality *sc.QualityReport `json:"quality,omitempty"`
+
+	Logs       []JobLogEntry `json:"logs"`
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+
+	done chan struct{}
+}
+
+// why generation runs as jobs:
+// - a reasoning model plus sclang routinely outlasts proxy timeouts
+// - a fixed pool of workers caps what we spend with a provider at once
+// - the log lets a client show which attempt it's on and why one failed
+type JobManager struct {
+	mu    sync.Mutex
+	jobs  map[string]*Job
+	queue chan *Job
+}
+
+var (
+	defaultJobs     *JobManager
+	defaultJobsOnce sync.Once
+)
+
+// NewJobManager starts workers that generate queued synths one at a time each
+func NewJobManager(workers int) *JobManager {
+	m := &JobManager{
+		jobs:  make(map[string]*Job),
+		queue: make(chan *Job, maxQueuedJobs),
+	}
+	for i := 0; i < workers; i++ {
+		go m.work()
+	}
+	return m
+}
+
+// DefaultJobs returns the manager sized by SYNTH_GENERATION_WORKERS
+func DefaultJobs() *JobManager {
+	defaultJobsOnce.Do(func() {
+		workers := config.DefaultSynthGenerationWorkers
+		if cfg, ok := config.Lookup(); ok {
+			workers = cfg.SynthGenerationWorkers
+		}
+		defaultJobs = NewJobManager(workers)
+	})
+	return defaultJobs
+}
+
+// Submit checks req's provider and queues it, failing with ErrJobQueueFull
+// rather than waiting when every slot is taken
+func (m *JobManager) Submit(req GenerationRequest) (Job, error) {
+	if _, err := GetProvider(req.Provider); err != nil {
+		return Job{}, err
+	}
+
+	now := time.Now()
+	job := &Job{
+		Id:        newJobId(),
+		Request:   req,
+		State:     JobQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+		done:      make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneLocked(now)
+
+	select {
+	case m.queue <- job:
+	default:
+		return Job{}, ErrJobQueueFull
+	}
+	m.jobs[job.Id] = job
+	m.logLocked(job, "queued")
+	log.Printf("[SYNTH-GEN][%s] Queued (provider=%q, model=%q)", job.Id, req.Provider, req.Model)
+	return job.snapshot(), nil
+}
+
+// Get returns a snapshot of a job
+func (m *JobManager) Get(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrUnknownJob
+	}
+	return job.snapshot(), nil
+}
+
+// Wait blocks until a job is ready, quarantined or failed, or ctx ends
+func (m *JobManager) Wait(ctx context.Context, id string) (Job, error) {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	m.mu.Unlock()
+	if !ok {
+		return Job{}, ErrUnknownJob
+	}
+
+	select {
+	case <-job.done:
+	case <-ctx.Done():
+		return Job{}, ctx.Err()
+	}
+	return m.Get(id)
+}
+
+func (m *JobManager) work() {
+	for job := range m.queue {
+		m.run(job)
+	}
+}
+
+func (m *JobManager) run(job *Job) {
+	req := job.Request
+	generated, err := GenerateSynthCode(req.Provider, req.Prompt, req.Model, func(state, message string) {
+		m.progress(job, state, message)
+	})
+	if err != nil {
+		m.finish(job, generated, nil, err)
+		return
+	}
+
+	m.progress(job, JobChecking, "rendering offline for the quality gate")
+	report, err := quality.Gate(generated.Id)
+	m.finish(job, generated, report, err)
+}
+
+func (m *JobManager) progress(job *Job, state, message string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job.State = state
+	m.logLocked(job, message)
+}
+
+func (m *JobManager) finish(job *Job, generated *GeneratedSynth, report *sc.QualityReport, err error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer close(job.done)
+
+	job.FinishedAt = &now
+	// a failed generation still reports what it spent
+	if generated != nil {
+		job.Model = generated.Model
+		job.Usage = &generated.Usage
+		job.Attempts = len(generated.Attempts)
+		// Code is only set once sclang accepted it, so without it there's
+		// no synthdef to name, just an id nothing was compiled under
+		if generated.Code != "" {
+			job.Code = generated.Code
+			job.SynthDef = generated.Id
+		}
+	}
+	job.Quality = report
+	if err != nil {
+		job.State = JobFailed
+		job.Error = err.Error()
+		m.logLocked(job, "failed: "+err.Error())
+		log.Printf("[SYNTH-GEN][%s] Failed: %v", job.Id, err)
+		return
+	}
+
+	if !report.Passed {
+		job.State = JobQuarantined
+		job.Error = "failed the quality gate: " + strings.Join(report.Failures, "; ")
+		m.logLocked(job, "quarantined: "+strings.Join(report.Failures, "; "))
+		log.Printf("[SYNTH-GEN][%s] Quarantined %s", job.Id, generated.Id)
+		return
+	}
+
+	job.State = JobReady
+	m.logLocked(job, "ready as "+generated.Id)
+	log.Printf("[SYNTH-GEN][%s] Ready as %s", job.Id, generated.Id)
+}
+
+func (m *JobManager) logLocked(job *Job, message string) {
+	job.UpdatedAt = time.Now()
+	job.Logs = append(job.Logs, JobLogEntry{Time: job.UpdatedAt, Message: message})
+	if len(job.Logs) > maxJobLogEntries {
+		job.Logs = job.Logs[len(job.Logs)-maxJobLogEntries:]
+	}
+}
+
+func (m *JobManager) pruneLocked(now time.Time) {
+	for id, job := range m.jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > jobRetention {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// snapshot copies the job so callers can't race the worker updating it
+func (j *Job) snapshot() Job {
+	copied := *j
+	copied.Logs = append([]JobLogEntry(nil), j.Logs...)
+	if j.Usage != nil {
+		usage := *j.Usage
+		copied.Usage = &usage
+	}
+	if j.Quality != nil {
+		report := *j.Quality
+		report.Failures = append([]string(nil), j.Quality.Failures...)
+		copied.Quality = &report
+	}
+	return copied
+}
+
+func newJobId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
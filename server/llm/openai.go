@@ -0,0 +1,88 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ollama serves whatever has been pulled; this is a reasonable coder to start with
+const defaultOllamaModel = "qwen2.5-coder"
+
+// OpenAIProvider talks to the OpenAI chat completions api, or to anything
+// serving the same api at another base url
+type OpenAIProvider struct {
+	name         string
+	defaultModel string
+	client       *openai.Client
+	// most compatible servers only understand max_tokens, while OpenAI's
+	// reasoning models only accept max_completion_tokens
+	legacyMaxTokens bool
+}
+
+// NewOpenAIProvider returns the provider for api.openai.com
+func NewOpenAIProvider(apiKey string) *OpenAIProvider {
+	return &OpenAIProvider{
+		name:         ProviderOpenAI,
+		defaultModel: openai.O1Preview,
+		client:       openai.NewClient(apiKey),
+	}
+}
+
+// NewOpenAICompatibleProvider returns a provider for an OpenAI-compatible
+// server such as ollama or vllm. baseURL includes the version path, e.g.
+// http://localhost:11434/v1. apiKey may be empty for local servers.
+func NewOpenAICompatibleProvider(name, baseURL, apiKey, defaultModel string) *OpenAIProvider {
+	clientConfig := openai.DefaultConfig(apiKey)
+	clientConfig.BaseURL = baseURL
+	return &OpenAIProvider{
+		name:            name,
+		defaultModel:    defaultModel,
+		client:          openai.NewClientWithConfig(clientConfig),
+		legacyMaxTokens: true,
+	}
+}
+
+func (p *OpenAIProvider) Name() string         { return p.name }
+func (p *OpenAIProvider) DefaultModel() string { return p.defaultModel }
+
+func (p *OpenAIProvider) Complete(ctx context.Context, req Request) (*Response, error) {
+	model := req.Model
+	if model == "" {
+		model = p.defaultModel
+	}
+	if model == "" {
+		return nil, fmt.Errorf("%s: no model given and no default configured", p.name)
+	}
+
+	chatReq := openai.ChatCompletionRequest{Model: model}
+	for _, msg := range req.Messages {
+		chatReq.Messages = append(chatReq.Messages, openai.ChatCompletionMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		})
+	}
+	if p.legacyMaxTokens {
+		chatReq.MaxTokens = req.MaxTokens
+	} else {
+		chatReq.MaxCompletionTokens = req.MaxTokens
+	}
+
+	resp, err := p.client.CreateChatCompletion(ctx, chatReq)
+	if err != nil {
+		return nil, fmt.Errorf("%s API error: %v", p.name, err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response from %s", p.name)
+	}
+
+	return &Response{
+		Text:  resp.Choices[0].Message.Content,
+		Model: resp.Model,
+		Usage: Usage{
+			InputTokens:  resp.Usage.PromptTokens,
+			OutputTokens: resp.Usage.CompletionTokens,
+		},
+	}, nil
+}
@@ -0,0 +1,131 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newOpenAICompatibleStub(t *testing.T, handler http.HandlerFunc) *OpenAIProvider {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return NewOpenAICompatibleProvider("local", server.URL+"/v1", "", "stub-model")
+}
+
+func TestOpenAICompatibleComplete(t *testing.T) {
+	// recorded by the handler, checked once Complete returns
+	var (
+		path string
+		body map[string]interface{}
+	)
+	provider := newOpenAICompatibleStub(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"model": "stub-model:7b",
+			"choices": [{"index": 0, "message": {"role": "assistant", "content": "var sound = SinOsc.ar;"}}],
+			"usage": {"prompt_tokens": 12, "completion_tokens": 34}
+		}`))
+	})
+
+	if provider.Name() != "local" {
+		t.Errorf("name = %q, want local", provider.Name())
+	}
+	resp, err := provider.Complete(context.Background(), Request{
+		Messages:  []Message{{Role: RoleUser, Content: "write a synth"}},
+		MaxTokens: 100,
+	})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+
+	if path != "/v1/chat/completions" {
+		t.Errorf("path = %q, want /v1/chat/completions", path)
+	}
+	if body["model"] != "stub-model" {
+		t.Errorf("model = %v, want the default stub-model", body["model"])
+	}
+	// compatible servers get the older field
+	if body["max_tokens"] != float64(100) {
+		t.Errorf("max_tokens = %v, want 100", body["max_tokens"])
+	}
+	if _, ok := body["max_completion_tokens"]; ok {
+		t.Errorf("max_completion_tokens sent to a compatible server")
+	}
+
+	if resp.Text != "var sound = SinOsc.ar;" {
+		t.Errorf("text = %q", resp.Text)
+	}
+	if resp.Model != "stub-model:7b" {
+		t.Errorf("model = %q, want stub-model:7b", resp.Model)
+	}
+	if resp.Usage != (Usage{InputTokens: 12, OutputTokens: 34}) {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestOpenAICompatibleCompleteErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{
+			name:    "error body",
+			status:  http.StatusNotFound,
+			body:    `{"error": {"message": "model \"missing\" not found", "type": "not_found_error"}}`,
+			wantErr: `model "missing" not found`,
+		},
+		{
+			name:    "non-json error",
+			status:  http.StatusBadGateway,
+			body:    "<html>bad gateway</html>",
+			wantErr: "local API error",
+		},
+		{
+			name:    "no choices",
+			status:  http.StatusOK,
+			body:    `{"model": "stub-model", "choices": []}`,
+			wantErr: "no response from local",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newOpenAICompatibleStub(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+
+			resp, err := provider.Complete(context.Background(), Request{
+				Messages: []Message{{Role: RoleUser, Content: "write a synth"}},
+			})
+			if err == nil {
+				t.Fatalf("Complete returned %+v, want an error", resp)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOpenAICompatibleCompleteNeedsModel(t *testing.T) {
+	provider := NewOpenAICompatibleProvider("local", "http://127.0.0.1:0/v1", "", "")
+	if _, err := provider.Complete(context.Background(), Request{
+		Messages: []Message{{Role: RoleUser, Content: "write a synth"}},
+	}); err == nil {
+		t.Fatal("Complete without a model succeeded")
+	}
+}
@@ -0,0 +1,152 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/po-studio/server/config"
+)
+
+// provider names registered from config
+const (
+	ProviderOpenAI           = "openai"
+	ProviderAnthropic        = "anthropic"
+	ProviderOllama           = "ollama"
+	ProviderOpenAICompatible = "openai-compatible"
+)
+
+// DefaultProvider is used when a request doesn't name one
+const DefaultProvider = ProviderOpenAI
+
+// conversation roles, shared by every backend we support
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is one turn of a conversation
+type Message struct {
+	Role    string
+	Content string
+}
+
+// Request is a conversation for the model to continue, ending with a user turn
+type Request struct {
+	// empty means the provider's default model
+	Model     string
+	Messages  []Message
+	MaxTokens int
+}
+
+// Usage is what a completion cost, as reported by the backend
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// Response is a model's reply
+type Response struct {
+	Text string
+	// the model that actually answered, which may differ from an alias asked for
+	Model string
+	Usage Usage
+}
+
+// why providers sit behind an interface:
+// - comparing models across vendors shouldn't touch the generation flow
+// - local models (ollama, vllm) and test stubs only differ by base url
+type Provider interface {
+	Name() string
+	DefaultModel() string
+	Complete(ctx context.Context, req Request) (*Response, error)
+}
+
+// UnknownProviderError is returned for a provider name nothing is
+// registered under, including ones whose credentials aren't configured
+type UnknownProviderError struct {
+	Name      string
+	Available []string
+}
+
+func (e *UnknownProviderError) Error() string {
+	return fmt.Sprintf("unknown llm provider %q (available: %s)", e.Name, strings.Join(e.Available, ", "))
+}
+
+var registry = struct {
+	sync.Mutex
+	providers map[string]Provider
+	defaults  sync.Once
+}{providers: make(map[string]Provider)}
+
+// Register adds p under its name, replacing any provider already there
+func Register(p Provider) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.providers[p.Name()] = p
+}
+
+// GetProvider returns the provider registered under name, or the default
+// provider for an empty name
+func GetProvider(name string) (Provider, error) {
+	registerDefaultProviders()
+	if name == "" {
+		name = DefaultProvider
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	if p, ok := registry.providers[name]; ok {
+		return p, nil
+	}
+	return nil, &UnknownProviderError{Name: name, Available: providerNamesLocked()}
+}
+
+// ProviderNames lists the registered providers, sorted
+func ProviderNames() []string {
+	registerDefaultProviders()
+	registry.Lock()
+	defer registry.Unlock()
+	return providerNamesLocked()
+}
+
+func providerNamesLocked() []string {
+	names := make([]string, 0, len(registry.providers))
+	for name := range registry.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// registerDefaultProviders registers a provider for each backend the
+// config has credentials for. Providers registered before this runs win,
+// so a test can swap in a stub under a real name without any config.
+func registerDefaultProviders() {
+	registry.defaults.Do(func() {
+		cfg, ok := config.Lookup()
+		if !ok {
+			return
+		}
+		defaults := []Provider{NewOpenAIProvider(cfg.OpenAIAPIKey)}
+		if cfg.AnthropicAPIKey != "" {
+			defaults = append(defaults, NewAnthropicProvider(cfg.AnthropicAPIKey, ""))
+		}
+		if cfg.OllamaBaseURL != "" {
+			defaults = append(defaults, NewOpenAICompatibleProvider(ProviderOllama, cfg.OllamaBaseURL, "", defaultOllamaModel))
+		}
+		if cfg.OpenAICompatibleBaseURL != "" {
+			defaults = append(defaults, NewOpenAICompatibleProvider(ProviderOpenAICompatible, cfg.OpenAICompatibleBaseURL, cfg.OpenAICompatibleAPIKey, ""))
+		}
+
+		registry.Lock()
+		defer registry.Unlock()
+		for _, p := range defaults {
+			if _, ok := registry.providers[p.Name()]; !ok {
+				registry.providers[p.Name()] = p
+			}
+		}
+	})
+}
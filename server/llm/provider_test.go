@@ -0,0 +1,48 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type stubProvider struct{ name string }
+
+func (p stubProvider) Name() string         { return p.name }
+func (p stubProvider) DefaultModel() string { return "stub" }
+func (p stubProvider) Complete(ctx context.Context, req Request) (*Response, error) {
+	return &Response{Text: "ok", Model: "stub"}, nil
+}
+
+func TestGetProvider(t *testing.T) {
+	Register(stubProvider{name: "test-stub"})
+
+	p, err := GetProvider("test-stub")
+	if err != nil {
+		t.Fatalf("GetProvider: %v", err)
+	}
+	if p.Name() != "test-stub" {
+		t.Errorf("name = %q, want test-stub", p.Name())
+	}
+}
+
+func TestGetProviderUnknown(t *testing.T) {
+	Register(stubProvider{name: "test-stub"})
+
+	_, err := GetProvider("no-such-provider")
+	var unknown *UnknownProviderError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("error = %v, want *UnknownProviderError", err)
+	}
+	if unknown.Name != "no-such-provider" {
+		t.Errorf("Name = %q, want no-such-provider", unknown.Name)
+	}
+
+	found := false
+	for _, name := range unknown.Available {
+		found = found || name == "test-stub"
+	}
+	if !found {
+		t.Errorf("Available = %v, want it to list test-stub", unknown.Available)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"os/signal"
 
 	"github.com/po-studio/server/config"
+	"github.com/po-studio/server/generator"
 	"github.com/po-studio/server/routes"
 )
 
@@ -30,6 +31,9 @@ func main() {
 		os.Exit(0)
 	}()
 
+	// grows the synth library on a schedule, when configured
+	generator.Default().Start()
+
 	router := routes.NewRouter()
 
 	fmt.Println("Server started at http://0.0.0.0:8080")
@@ -0,0 +1,201 @@
+package quality
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/po-studio/server/config"
+	"github.com/po-studio/server/render"
+	sc "github.com/po-studio/server/supercollider"
+	"github.com/po-studio/server/utils"
+)
+
+// Thresholds are the bounds a def's analysis has to fall within
+type Thresholds struct {
+	CheckDuration       time.Duration
+	MinPeakDb           float64
+	MinRMSDb            float64
+	MaxRMSDb            float64
+	MaxDCOffset         float64
+	MaxSpectralFlatness float64
+	MaxSilenceRatio     float64
+	MaxClippedRatio     float64
+}
+
+// ConfiguredThresholds reads the QUALITY_* settings
+func ConfiguredThresholds() Thresholds {
+	cfg := config.Get()
+	return Thresholds{
+		CheckDuration:       cfg.QualityCheckDuration,
+		MinPeakDb:           cfg.QualityMinPeakDb,
+		MinRMSDb:            cfg.QualityMinRMSDb,
+		MaxRMSDb:            cfg.QualityMaxRMSDb,
+		MaxDCOffset:         cfg.QualityMaxDCOffset,
+		MaxSpectralFlatness: cfg.QualityMaxSpectralFlatness,
+		MaxSilenceRatio:     cfg.QualityMaxSilenceRatio,
+		MaxClippedRatio:     cfg.QualityMaxClippedRatio,
+	}
+}
+
+// Evaluate lists every threshold the analysis misses
+func Evaluate(a *sc.AudioAnalysis, t Thresholds) []string {
+	var failures []string
+	fail := func(format string, args ...interface{}) {
+		failures = append(failures, fmt.Sprintf(format, args...))
+	}
+
+	if a.PeakDb < t.MinPeakDb {
+		fail("silent: peak %.1f dBFS is below %.1f", a.PeakDb, t.MinPeakDb)
+	}
+	if a.RMSDb < t.MinRMSDb {
+		fail("too quiet: rms %.1f dBFS is below %.1f", a.RMSDb, t.MinRMSDb)
+	}
+	if a.RMSDb > t.MaxRMSDb {
+		fail("too loud: rms %.1f dBFS is above %.1f", a.RMSDb, t.MaxRMSDb)
+	}
+	if math.Abs(a.DCOffset) > t.MaxDCOffset {
+		fail("dc offset: %.3f is beyond ±%.3f", a.DCOffset, t.MaxDCOffset)
+	}
+	if a.SpectralFlatness > t.MaxSpectralFlatness {
+		fail("noise-like: spectral flatness %.2f is above %.2f", a.SpectralFlatness, t.MaxSpectralFlatness)
+	}
+	if a.SilenceRatio > t.MaxSilenceRatio {
+		fail("mostly silent: %.0f%% of the render, more than %.0f%%", a.SilenceRatio*100, t.MaxSilenceRatio*100)
+	}
+	if a.ClippedRatio > t.MaxClippedRatio {
+		fail("clipping: %.3f%% of samples at full scale, more than %.3f%%", a.ClippedRatio*100, t.MaxClippedRatio*100)
+	}
+	return failures
+}
+
+// why generated defs pass a gate before they're served:
+// - compiling says nothing about what a def sounds like
+// - silence, dc, clipping and feedback all show up in an offline render
+// - a listener shouldn't be the one to find out, volume up, in headphones
+//
+// Gate renders a freshly generated def, measures it against the configured
+// thresholds and then either adds it to the library sessions pick from or
+// moves it to quarantine. The report is saved beside the def either way,
+// where the catalog picks it up. An error means the def couldn't be
+// checked or moved, and it isn't served either way.
+func Gate(synthDefName string) (*sc.QualityReport, error) {
+	thresholds := ConfiguredThresholds()
+	analysis, err := measure(synthDefName, thresholds.CheckDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &sc.QualityReport{
+		Analysis:  *analysis,
+		Failures:  Evaluate(analysis, thresholds),
+		CheckedAt: time.Now(),
+	}
+	report.Passed = len(report.Failures) == 0
+
+	generatedDir, err := sc.GeneratedSynthDefDirectory()
+	if err != nil {
+		return nil, err
+	}
+
+	if report.Passed {
+		log.Printf("[QUALITY] %s passed: %+v", synthDefName, report.Analysis)
+		// renders of the generated def show its report too
+		if err := sc.SaveQualityReport(generatedDir, synthDefName, report); err != nil {
+			return report, fmt.Errorf("failed to save quality report: %w", err)
+		}
+		return report, publish(generatedDir, synthDefName, report)
+	}
+	log.Printf("[QUALITY] %s failed: %v", synthDefName, report.Failures)
+	return report, quarantine(generatedDir, synthDefName, report)
+}
+
+// measure renders the def offline and analyzes the result
+func measure(synthDefName string, duration time.Duration) (*sc.AudioAnalysis, error) {
+	renders := render.Default()
+	job, err := renders.Submit(render.Request{Synth: synthDefName, Duration: duration.Seconds()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue check render: %w", err)
+	}
+
+	job, err = renders.Wait(context.Background(), job.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer renders.Remove(job.Id)
+	if job.Status != render.StatusDone {
+		return nil, fmt.Errorf("check render failed: %s", job.Error)
+	}
+
+	_, path, err := renders.File(job.Id)
+	if err != nil {
+		return nil, err
+	}
+	return render.AnalyzeFile(path)
+}
+
+// publish copies a def that passed into the directory sessions pick from.
+// The def goes in under a temp name and is renamed last, so
+// GetRandomSynthDefName never sees half a file or a def without its report.
+func publish(generatedDir, synthDefName string, report *sc.QualityReport) error {
+	libraryDir := utils.SCSynthDefDirectory
+	if err := sc.SaveQualityReport(libraryDir, synthDefName, report); err != nil {
+		return fmt.Errorf("failed to add %s to synthdef library: %w", synthDefName, err)
+	}
+
+	src, err := os.Open(filepath.Join(generatedDir, synthDefName+".scsyndef"))
+	if err != nil {
+		return fmt.Errorf("failed to open generated synthdef: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := os.CreateTemp(libraryDir, ".generated-*")
+	if err != nil {
+		return fmt.Errorf("failed to add %s to synthdef library: %w", synthDefName, err)
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(dst.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(dst.Name(), filepath.Join(libraryDir, synthDefName+".scsyndef"))
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+		return fmt.Errorf("failed to add %s to synthdef library: %w", synthDefName, err)
+	}
+
+	log.Printf("[QUALITY] Added %s to %s", synthDefName, libraryDir)
+	return nil
+}
+
+// quarantine moves a def that failed out of the generated directory, so
+// renders can't find it either, keeping it and its report to look at
+func quarantine(generatedDir, synthDefName string, report *sc.QualityReport) error {
+	quarantineDir, err := sc.QuarantineDirectory()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(quarantineDir, 0755); err != nil {
+		return fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	if err := sc.SaveQualityReport(quarantineDir, synthDefName, report); err != nil {
+		return fmt.Errorf("failed to save quality report: %w", err)
+	}
+
+	name := synthDefName + ".scsyndef"
+	if err := os.Rename(filepath.Join(generatedDir, name), filepath.Join(quarantineDir, name)); err != nil {
+		return fmt.Errorf("failed to quarantine %s: %w", synthDefName, err)
+	}
+
+	log.Printf("[QUALITY] Quarantined %s in %s", synthDefName, quarantineDir)
+	return nil
+}
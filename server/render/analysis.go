@@ -0,0 +1,306 @@
+package render
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	sc "github.com/po-studio/server/supercollider"
+)
+
+const (
+	// digital silence has no level in dB, which json can't encode
+	analysisFloorDb = -100.0
+	// the same thresholds the live meter alarms on
+	silenceThresholdDb  = -60.0
+	clippingThresholdDb = -0.1
+	// length of the windows the silence ratio is counted in
+	silenceWindow = 0.1
+	// samples per fft frame for spectral flatness; ~43ms at 48k
+	flatnessFrameSize = 2048
+)
+
+// wav sample formats we read
+const (
+	wavFormatPCM   = 1
+	wavFormatFloat = 3
+)
+
+// AnalyzeFile measures a wav render
+func AnalyzeFile(path string) (*sc.AudioAnalysis, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return analyzeWAV(bufio.NewReader(f))
+}
+
+type wavFormat struct {
+	format        uint16
+	channels      uint16
+	sampleRate    uint32
+	bitsPerSample uint16
+}
+
+// why we parse wav by hand:
+// - renders are always scsynth's own int16 or float output
+// - chunks are walked so a LIST or fact chunk before data doesn't matter
+func analyzeWAV(r io.Reader) (*sc.AudioAnalysis, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("failed to read wav header: %w", err)
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return nil, errors.New("not a wav file")
+	}
+
+	var format *wavFormat
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return nil, fmt.Errorf("no data chunk in wav: %w", err)
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		switch id {
+		case "fmt ":
+			body := make([]byte, size+size%2)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return nil, fmt.Errorf("failed to read wav format: %w", err)
+			}
+			if size < 16 {
+				return nil, errors.New("short wav format chunk")
+			}
+			format = &wavFormat{
+				format:        binary.LittleEndian.Uint16(body[0:2]),
+				channels:      binary.LittleEndian.Uint16(body[2:4]),
+				sampleRate:    binary.LittleEndian.Uint32(body[4:8]),
+				bitsPerSample: binary.LittleEndian.Uint16(body[14:16]),
+			}
+		case "data":
+			if format == nil {
+				return nil, errors.New("wav data before format")
+			}
+			// data is the last chunk scsynth writes, so read to the end
+			return analyzeSamples(r, *format)
+		default:
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return nil, fmt.Errorf("failed to skip wav chunk %q: %w", id, err)
+			}
+		}
+	}
+}
+
+func analyzeSamples(r io.Reader, format wavFormat) (*sc.AudioAnalysis, error) {
+	read, err := sampleReader(format)
+	if err != nil {
+		return nil, err
+	}
+	channels := int(format.channels)
+	sampleSize := int(format.bitsPerSample / 8)
+	windowFrames := int(float64(format.sampleRate) * silenceWindow)
+	if windowFrames < 1 {
+		windowFrames = 1
+	}
+
+	silenceThreshold := math.Pow(10, silenceThresholdDb/20)
+	clippingThreshold := math.Pow(10, clippingThresholdDb/20)
+
+	var (
+		frames, clipped        int
+		peak, sumSquares       float64
+		windows, silentWindows int
+		windowFill             int
+		windowSquares          float64
+	)
+	sums := make([]float64, channels)
+	flatness := newFlatnessMeter(silenceThreshold)
+	frame := make([]byte, channels*sampleSize)
+	for {
+		if _, err := io.ReadFull(r, frame); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return nil, fmt.Errorf("failed to read wav samples: %w", err)
+		}
+		var mono float64
+		for ch := 0; ch < channels; ch++ {
+			v := read(frame[ch*sampleSize:])
+			abs := math.Abs(v)
+			if abs > peak {
+				peak = abs
+			}
+			if abs >= clippingThreshold {
+				clipped++
+			}
+			sums[ch] += v
+			sumSquares += v * v
+			windowSquares += v * v
+			mono += v
+		}
+		flatness.add(mono / float64(channels))
+		frames++
+
+		windowFill++
+		if windowFill == windowFrames {
+			windows++
+			if math.Sqrt(windowSquares/float64(windowFrames*channels)) < silenceThreshold {
+				silentWindows++
+			}
+			windowFill, windowSquares = 0, 0
+		}
+	}
+	if frames == 0 {
+		return nil, errors.New("wav has no samples")
+	}
+
+	analysis := &sc.AudioAnalysis{
+		Duration:         float64(frames) / float64(format.sampleRate),
+		PeakDb:           toDb(peak),
+		RMSDb:            toDb(math.Sqrt(sumSquares / float64(frames*channels))),
+		SpectralFlatness: flatness.mean(),
+		ClippedRatio:     float64(clipped) / float64(frames*channels),
+	}
+	for _, sum := range sums {
+		if dc := sum / float64(frames); math.Abs(dc) > math.Abs(analysis.DCOffset) {
+			analysis.DCOffset = dc
+		}
+	}
+	if windows > 0 {
+		analysis.SilenceRatio = float64(silentWindows) / float64(windows)
+	}
+	return analysis, nil
+}
+
+// why flatness is measured per frame:
+// - runaway feedback and noise blowups read as flat spectra
+// - averaging whole-file power would smear a tonal piece into noise
+type flatnessMeter struct {
+	window []float64
+	frame  []float64
+	re, im []float64
+	// frames quieter than this are skipped; silence has no spectral shape
+	floor  float64
+	total  float64
+	frames int
+}
+
+func newFlatnessMeter(floor float64) *flatnessMeter {
+	window := make([]float64, flatnessFrameSize)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(flatnessFrameSize-1))
+	}
+	return &flatnessMeter{
+		window: window,
+		frame:  make([]float64, 0, flatnessFrameSize),
+		re:     make([]float64, flatnessFrameSize),
+		im:     make([]float64, flatnessFrameSize),
+		floor:  floor,
+	}
+}
+
+func (f *flatnessMeter) add(sample float64) {
+	f.frame = append(f.frame, sample)
+	if len(f.frame) < flatnessFrameSize {
+		return
+	}
+	defer func() { f.frame = f.frame[:0] }()
+
+	var sumSquares float64
+	for _, v := range f.frame {
+		sumSquares += v * v
+	}
+	if math.Sqrt(sumSquares/flatnessFrameSize) < f.floor {
+		return
+	}
+
+	re, im := f.re, f.im
+	for i, v := range f.frame {
+		re[i] = v * f.window[i]
+		im[i] = 0
+	}
+	fft(re, im)
+
+	// geometric over arithmetic mean of the power spectrum, without dc
+	const epsilon = 1e-20
+	var logSum, sum float64
+	bins := flatnessFrameSize / 2
+	for k := 1; k <= bins; k++ {
+		power := re[k]*re[k] + im[k]*im[k] + epsilon
+		logSum += math.Log(power)
+		sum += power
+	}
+	f.total += math.Exp(logSum/float64(bins)) / (sum / float64(bins))
+	f.frames++
+}
+
+func (f *flatnessMeter) mean() float64 {
+	if f.frames == 0 {
+		return 0
+	}
+	return f.total / float64(f.frames)
+}
+
+// fft transforms re and im in place; their length must be a power of two
+func fft(re, im []float64) {
+	n := len(re)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			re[i], re[j] = re[j], re[i]
+			im[i], im[j] = im[j], im[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		angle := -2 * math.Pi / float64(size)
+		wRe, wIm := math.Cos(angle), math.Sin(angle)
+		for start := 0; start < n; start += size {
+			uRe, uIm := 1.0, 0.0
+			for k := 0; k < size/2; k++ {
+				a, b := start+k, start+k+size/2
+				tRe := re[b]*uRe - im[b]*uIm
+				tIm := re[b]*uIm + im[b]*uRe
+				re[b], im[b] = re[a]-tRe, im[a]-tIm
+				re[a], im[a] = re[a]+tRe, im[a]+tIm
+				uRe, uIm = uRe*wRe-uIm*wIm, uRe*wIm+uIm*wRe
+			}
+		}
+	}
+}
+
+// sampleReader decodes one sample as -1..1
+func sampleReader(format wavFormat) (func([]byte) float64, error) {
+	if format.channels == 0 || format.sampleRate == 0 {
+		return nil, errors.New("wav has no channels")
+	}
+	switch {
+	case format.format == wavFormatPCM && format.bitsPerSample == 16:
+		return func(b []byte) float64 {
+			return float64(int16(binary.LittleEndian.Uint16(b))) / 32768
+		}, nil
+	case format.format == wavFormatFloat && format.bitsPerSample == 32:
+		return func(b []byte) float64 {
+			return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported wav sample format %d at %d bits", format.format, format.bitsPerSample)
+	}
+}
+
+func toDb(amplitude float64) float64 {
+	if amplitude <= 0 {
+		return analysisFloorDb
+	}
+	return math.Max(20*math.Log10(amplitude), analysisFloorDb)
+}
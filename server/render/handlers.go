@@ -0,0 +1,98 @@
+package render
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gorilla/mux"
+	"github.com/po-studio/server/config"
+	sc "github.com/po-studio/server/supercollider"
+)
+
+func authorized(w http.ResponseWriter, r *http.Request) bool {
+	apiKey := r.Header.Get("Awestruck-API-Key")
+	if apiKey == "" || !config.ValidateAwestruckAPIKey(apiKey) {
+		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrUnknownJob), errors.Is(err, sc.ErrUnknownSynthDef):
+		return http.StatusNotFound
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func writeJob(w http.ResponseWriter, status int, job Job) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(job)
+}
+
+// HandleRender queues an offline render and points at its status
+func HandleRender(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r) {
+		return
+	}
+
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	job, err := Default().Submit(req)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Location", "/render/"+job.Id)
+	writeJob(w, http.StatusAccepted, job)
+}
+
+// HandleRenderStatus reports a render's progress
+func HandleRenderStatus(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r) {
+		return
+	}
+
+	job, err := Default().Get(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	writeJob(w, http.StatusOK, job)
+}
+
+// HandleRenderFile downloads a finished render
+func HandleRenderFile(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r) {
+		return
+	}
+
+	job, path, err := Default().File(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	if job.Status != StatusDone {
+		http.Error(w, fmt.Sprintf("Render is %s", job.Status), http.StatusConflict)
+		return
+	}
+
+	contentType := "audio/wav"
+	if job.Request.Format == FormatOpus {
+		contentType = "audio/ogg"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", job.Request.Synth+filepath.Ext(path)))
+	http.ServeFile(w, r, path)
+}
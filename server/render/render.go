@@ -0,0 +1,370 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/po-studio/server/config"
+	sc "github.com/po-studio/server/supercollider"
+)
+
+// job states
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// output formats
+const (
+	FormatWAV  = "wav"
+	FormatOpus = "opus"
+)
+
+const (
+	sampleRate     = 48000
+	outputChannels = 2
+	// longest render we accept
+	maxDuration = config.MaxRenderDuration
+	// renders allowed to run at once; the rest queue
+	maxConcurrentRenders = 2
+	// scsynth renders far faster than realtime, so this only catches hangs
+	renderTimeoutBase = 30 * time.Second
+	// a ten minute wav is over 100mb, so finished renders don't stay long;
+	// an hour is plenty to poll for one and download it
+	renderRetention = time.Hour
+)
+
+var ErrUnknownJob = errors.New("render job not found")
+
+// Request describes a render
+type Request struct {
+	Synth  string           `json:"synth"`
+	Params sc.ControlValues `json:"params,omitempty"`
+	// seconds of audio to render
+	Duration float64 `json:"duration"`
+	// wav or opus, defaults to wav
+	Format string `json:"format,omitempty"`
+}
+
+func (r *Request) validate() error {
+	if r.Synth == "" {
+		return fmt.Errorf("synth is required")
+	}
+	if r.Duration <= 0 || r.Duration > maxDuration.Seconds() {
+		return fmt.Errorf("duration must be between 0 and %g seconds", maxDuration.Seconds())
+	}
+	switch r.Format {
+	case "":
+		r.Format = FormatWAV
+	case FormatWAV, FormatOpus:
+	default:
+		return fmt.Errorf("unsupported format %q (want wav or opus)", r.Format)
+	}
+	return nil
+}
+
+// Job is a render and its outcome
+type Job struct {
+	Id         string     `json:"id"`
+	Request    Request    `json:"request"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	Size       int64      `json:"size,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+	file string
+	done chan struct{}
+}
+
+// why renders run as jobs:
+// - long or generated defs shouldn't hold an http request open
+// - scsynth -N needs no jack or audio device, so it runs anywhere
+// - a few at a time keeps auditioning from starving live sessions
+type Manager struct {
+	mu   sync.Mutex
+	dir  string
+	jobs map[string]*Job
+	sem  chan struct{}
+}
+
+var (
+	defaultManager     *Manager
+	defaultManagerOnce sync.Once
+)
+
+// NewManager creates a manager writing renders to dir
+func NewManager(dir string) *Manager {
+	return &Manager{
+		dir:  dir,
+		jobs: make(map[string]*Job),
+		sem:  make(chan struct{}, maxConcurrentRenders),
+	}
+}
+
+// Default returns the manager for the configured renders directory
+func Default() *Manager {
+	defaultManagerOnce.Do(func() {
+		defaultManager = NewManager(config.Get().RendersDir)
+	})
+	return defaultManager
+}
+
+// Submit validates req and queues it
+func (m *Manager) Submit(req Request) (Job, error) {
+	if err := req.validate(); err != nil {
+		return Job{}, err
+	}
+	def, err := findSynthDef(req.Synth)
+	if err != nil {
+		return Job{}, err
+	}
+	if err := sc.ValidateParams(req.Synth, def.Controls, req.Params); err != nil {
+		return Job{}, err
+	}
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return Job{}, fmt.Errorf("failed to create renders directory: %w", err)
+	}
+
+	job := &Job{
+		Id:        newJobId(),
+		Request:   req,
+		Status:    StatusQueued,
+		CreatedAt: time.Now(),
+		done:      make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	m.pruneLocked(job.CreatedAt)
+	m.jobs[job.Id] = job
+	m.mu.Unlock()
+
+	go m.run(job, def.File)
+	return *job, nil
+}
+
+// Get returns a snapshot of a job
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrUnknownJob
+	}
+	return *job, nil
+}
+
+// File returns the path of a finished job's output
+func (m *Manager) File(id string) (Job, string, error) {
+	job, err := m.Get(id)
+	if err != nil {
+		return Job{}, "", err
+	}
+	return job, job.file, nil
+}
+
+// Wait blocks until a job is done or failed, or ctx ends
+func (m *Manager) Wait(ctx context.Context, id string) (Job, error) {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	m.mu.Unlock()
+	if !ok {
+		return Job{}, ErrUnknownJob
+	}
+
+	select {
+	case <-job.done:
+	case <-ctx.Done():
+		return Job{}, ctx.Err()
+	}
+	return m.Get(id)
+}
+
+// Remove forgets a finished job and deletes its output
+func (m *Manager) Remove(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return ErrUnknownJob
+	}
+	if job.FinishedAt == nil {
+		return fmt.Errorf("render %s is still %s", id, job.Status)
+	}
+	delete(m.jobs, id)
+	if job.file != "" {
+		return os.Remove(job.file)
+	}
+	return nil
+}
+
+func (m *Manager) pruneLocked(now time.Time) {
+	for id, job := range m.jobs {
+		if job.FinishedAt == nil || now.Sub(*job.FinishedAt) <= renderRetention {
+			continue
+		}
+		delete(m.jobs, id)
+		if job.file != "" {
+			if err := os.Remove(job.file); err != nil && !os.IsNotExist(err) {
+				log.Printf("[RENDER][%s][WARNING] Failed to remove expired render: %v", id, err)
+			}
+		}
+	}
+}
+
+func (m *Manager) setStatus(job *Job, status string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job.Status = status
+}
+
+func (m *Manager) finish(job *Job, file string, err error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer close(job.done)
+
+	job.FinishedAt = &now
+	if err != nil {
+		job.Status = StatusFailed
+		job.Error = err.Error()
+		log.Printf("[RENDER][%s] Failed: %v", job.Id, err)
+		return
+	}
+
+	job.Status = StatusDone
+	job.file = file
+	if stat, err := os.Stat(file); err == nil {
+		job.Size = stat.Size()
+	}
+	log.Printf("[RENDER][%s] Rendered %s to %s", job.Id, job.Request.Synth, file)
+}
+
+func (m *Manager) run(job *Job, defPath string) {
+	m.sem <- struct{}{}
+	defer func() { <-m.sem }()
+
+	m.setStatus(job, StatusRunning)
+	file, err := m.render(job, defPath)
+	m.finish(job, file, err)
+}
+
+func (m *Manager) render(job *Job, defPath string) (string, error) {
+	def, err := os.ReadFile(defPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read synthdef: %w", err)
+	}
+
+	req := job.Request
+	scorePath := filepath.Join(m.dir, job.Id+".osc")
+	wavPath := filepath.Join(m.dir, job.Id+".wav")
+	defer os.Remove(scorePath)
+
+	var score bytes.Buffer
+	if err := writeScore(&score, buildScore(def, req.Synth, req.Params, req.Duration)); err != nil {
+		return "", fmt.Errorf("failed to build score: %w", err)
+	}
+	if err := os.WriteFile(scorePath, score.Bytes(), 0644); err != nil {
+		return "", fmt.Errorf("failed to write score: %w", err)
+	}
+
+	timeout := renderTimeoutBase + time.Duration(req.Duration*float64(time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// scsynth -N <score> <input> <output> <rate> <header> <sample format> [options]
+	// "_" means no input file; -D 0 skips loading the synthdef directory
+	// since the score carries the def itself
+	cmd := exec.CommandContext(ctx, "scsynth",
+		"-N", scorePath, "_", wavPath,
+		strconv.Itoa(sampleRate), "WAV", "int16",
+		"-o", strconv.Itoa(outputChannels),
+		"-i", "0",
+		"-D", "0",
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(wavPath)
+		return "", fmt.Errorf("scsynth failed: %v\n%s", err, output)
+	}
+
+	if req.Format != FormatOpus {
+		return wavPath, nil
+	}
+
+	opusPath := filepath.Join(m.dir, job.Id+".opus")
+	defer os.Remove(wavPath)
+	if err := encodeOpus(ctx, wavPath, opusPath); err != nil {
+		return "", err
+	}
+	return opusPath, nil
+}
+
+// encodeOpus converts a render at the standard stream profile's settings,
+// so what you audition is close to what listeners get
+func encodeOpus(ctx context.Context, wavPath, opusPath string) error {
+	cmd := exec.CommandContext(ctx, "gst-launch-1.0", "-q",
+		"filesrc", "location="+wavPath, "!",
+		"wavparse", "!",
+		"audioconvert", "!",
+		"audioresample", "!",
+		"opusenc", "bitrate=128000", "frame-size=20", "complexity=10", "!",
+		"oggmux", "!",
+		"filesink", "location="+opusPath,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(opusPath)
+		return fmt.Errorf("opus encode failed: %v\n%s", err, output)
+	}
+	return nil
+}
+
+// findSynthDef looks in the directory scsynth loads from, then in the
+// directory SaveSynthDef compiles generated defs to
+func findSynthDef(name string) (*sc.CatalogEntry, error) {
+	catalogs := []*sc.Catalog{sc.DefaultCatalog()}
+	if generated, err := sc.GeneratedCatalog(); err == nil {
+		catalogs = append(catalogs, generated)
+	}
+
+	for _, catalog := range catalogs {
+		// a missing directory (e.g. on a ci box) just means no defs there
+		entry, err := catalog.Lookup(name)
+		if err != nil {
+			continue
+		}
+		// the quality gate moves generated defs out once it has judged
+		// them, which a cached entry doesn't know about until a rescan
+		if _, err := os.Stat(entry.File); err != nil {
+			if catalog.Refresh() != nil {
+				continue
+			}
+			if entry, err = catalog.Lookup(name); err != nil {
+				continue
+			}
+		}
+		return entry, nil
+	}
+	return nil, fmt.Errorf("%w %q", sc.ErrUnknownSynthDef, name)
+}
+
+func newJobId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
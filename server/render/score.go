@@ -0,0 +1,74 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/hypebeast/go-osc/osc"
+	sc "github.com/po-studio/server/supercollider"
+)
+
+// node the rendered synth runs as
+const renderNodeId = int32(1000)
+
+// scoreEvent is a set of commands scsynth runs at a point in score time
+type scoreEvent struct {
+	// seconds from the start of the render
+	at       float64
+	messages []*osc.Message
+}
+
+// buildScore loads def, plays it with params for duration seconds, then
+// frees it. scsynth -N stops rendering after the last event.
+func buildScore(def []byte, synthDefName string, params sc.ControlValues, duration float64) []scoreEvent {
+	start := []*osc.Message{osc.NewMessage("/d_recv", def)}
+	start = append(start, sc.NewNodeMessages(synthDefName, renderNodeId, params)...)
+
+	return []scoreEvent{
+		{at: 0, messages: start},
+		{at: duration, messages: []*osc.Message{osc.NewMessage("/n_free", renderNodeId)}},
+	}
+}
+
+// why we write the score by hand:
+// - an NRT score is a run of length-prefixed OSC bundles
+// - timetags count seconds from zero, which go-osc's Bundle can't express
+func writeScore(w io.Writer, events []scoreEvent) error {
+	sort.SliceStable(events, func(i, j int) bool { return events[i].at < events[j].at })
+
+	for _, event := range events {
+		bundle, err := marshalScoreBundle(event)
+		if err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, int32(len(bundle))); err != nil {
+			return err
+		}
+		if _, err := w.Write(bundle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func marshalScoreBundle(event scoreEvent) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("#bundle\x00")
+
+	seconds, fraction := math.Modf(event.at)
+	timetag := uint64(seconds)<<32 | uint64(fraction*(1<<32))
+	binary.Write(&buf, binary.BigEndian, timetag)
+
+	for _, msg := range event.messages {
+		data, err := msg.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		binary.Write(&buf, binary.BigEndian, int32(len(data)))
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
@@ -5,6 +5,9 @@ import (
 
 	"github.com/gorilla/mux"
 
+	"github.com/po-studio/server/generator"
+	"github.com/po-studio/server/jack"
+	"github.com/po-studio/server/render"
 	synth "github.com/po-studio/server/synth"
 	webrtc "github.com/po-studio/server/webrtc"
 )
@@ -23,18 +26,81 @@ func NewRouter() *mux.Router {
 	// for creating the webrtc offer once the client has fetched the config
 	router.HandleFunc("/offer", webrtc.HandleOffer).Methods("POST")
 
+	// standard WHEP egress for players like OBS and gstreamer's whepsrc
+	router.HandleFunc("/whep", webrtc.HandleWHEP).Methods("POST")
+	router.HandleFunc("/whep/{id}", webrtc.HandleWHEPResource).Methods("PATCH", "DELETE")
+
+	// opus encoding profiles an offer can select with "profile"
+	router.HandleFunc("/encoding-profiles", webrtc.HandleEncodingProfiles).Methods("GET")
+
 	// stops the webrtc connection and executes synthesis/session cleanup
 	router.HandleFunc("/stop", webrtc.HandleStop).Methods("POST")
 
 	router.HandleFunc("/ice-candidate", webrtc.HandleICECandidate).Methods("POST")
 
+	// server-sent stream of the server's own candidates, for trickle offers
+	router.HandleFunc("/ice-candidates", webrtc.HandleServerCandidates).Methods("GET")
+
 	// just for frontend -- displays the source code of the synth
 	// being synthesized/streamed in real-time
 	router.HandleFunc("/synth-code", webrtc.HandleSynthCode).Methods("GET")
 
-	// experimental, for testing generative LLM synths
-	// this should become a recurring background job
+	// lists the available synthdefs with their controls and graph metadata
+	router.HandleFunc("/synths", synth.ListSynths).Methods("GET")
+
+	// generated synthdefs the quality gate held back, with their measurements
+	router.HandleFunc("/synths/quarantine", synth.ListQuarantined).Methods("GET")
+
+	// reads or sets named controls on the running synth node
+	router.HandleFunc("/synth/params", webrtc.HandleSynthParams).Methods("GET", "POST")
+
+	// crossfades to another synthdef without renegotiating webrtc
+	router.HandleFunc("/synth/switch", webrtc.HandleSynthSwitch).Methods("POST")
+
+	// scsynth status: load, node counts and whether it's still answering
+	router.HandleFunc("/synth/health", webrtc.HandleSynthHealth).Methods("GET")
+
+	// per-session playlists that crossfade through synthdefs on a schedule
+	router.HandleFunc("/playlist", webrtc.HandlePlaylist).Methods("GET", "POST", "DELETE")
+	router.HandleFunc("/playlist/queue", webrtc.HandlePlaylistQueue).Methods("POST")
+	router.HandleFunc("/playlist/skip", webrtc.HandlePlaylistSkip).Methods("POST")
+	router.HandleFunc("/playlist/reorder", webrtc.HandlePlaylistReorder).Methods("POST")
+
+	// encoder bitrate chosen from receiver reports, plus engine health
+	router.HandleFunc("/session/stats", webrtc.HandleSessionStats).Methods("GET")
+
+	// records what the session's listener hears to ogg, flac or wav
+	router.HandleFunc("/recording", webrtc.HandleRecording).Methods("GET", "POST", "DELETE")
+	router.HandleFunc("/recordings", webrtc.HandleRecordings).Methods("GET")
+	router.HandleFunc("/recordings/{id}", webrtc.HandleRecordingFile).Methods("GET")
+
+	// broadcast rooms: one synth and pipeline, any number of listeners
+	router.HandleFunc("/rooms", webrtc.HandleRooms).Methods("GET", "POST")
+	router.HandleFunc("/rooms/{id}", webrtc.HandleRoom).Methods("GET", "DELETE")
+	router.HandleFunc("/rooms/{id}/listen", webrtc.HandleRoomListen).Methods("POST")
+	router.HandleFunc("/rooms/{id}/listeners/{listener}", webrtc.HandleRoomListener).Methods("DELETE")
+
+	// server-sent stream of output levels, spectrum and silence/clipping alarms
+	router.HandleFunc("/levels", webrtc.HandleLevels).Methods("GET")
+
+	// jack clients, ports and connections with the session owning each port
+	router.HandleFunc("/debug/jack", jack.HandleGraph).Methods("GET")
+
+	// offline scsynth renders for auditioning defs without a session
+	router.HandleFunc("/render", render.HandleRender).Methods("POST")
+	router.HandleFunc("/render/{id}", render.HandleRenderStatus).Methods("GET")
+	router.HandleFunc("/render/{id}/file", render.HandleRenderFile).Methods("GET")
+
+	// queues a generation job; poll its Location for state and logs.
+	// the generator below runs these on a schedule
 	router.HandleFunc("/generate-synth", synth.GenerateSynth).Methods("POST")
+	router.HandleFunc("/generate-synth/{id}", synth.GenerateSynthStatus).Methods("GET")
+
+	// background generator that grows the synth library: schedule, budget, recent runs
+	router.HandleFunc("/generator", generator.HandleStatus).Methods("GET")
+
+	// llm providers /generate-synth can use, per configured credentials
+	router.HandleFunc("/llm/providers", synth.ListProviders).Methods("GET")
 
 	return router
 }
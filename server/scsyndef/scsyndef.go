@@ -0,0 +1,343 @@
+// Package scsyndef parses SuperCollider's compiled synth definition format
+// (SCgf, versions 1 and 2) as written by SynthDef.writeDefFile.
+package scsyndef
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// Rate is the calculation rate of a UGen or one of its outputs
+type Rate int8
+
+const (
+	RateScalar  Rate = 0
+	RateControl Rate = 1
+	RateAudio   Rate = 2
+	RateDemand  Rate = 3
+)
+
+func (r Rate) String() string {
+	switch r {
+	case RateScalar:
+		return "scalar"
+	case RateControl:
+		return "control"
+	case RateAudio:
+		return "audio"
+	case RateDemand:
+		return "demand"
+	default:
+		return fmt.Sprintf("rate(%d)", int8(r))
+	}
+}
+
+// File is the parsed contents of a .scsyndef file
+type File struct {
+	Version int
+	Defs    []*SynthDef
+}
+
+// SynthDef is a single synth definition inside a file
+type SynthDef struct {
+	Name       string
+	Constants  []float32
+	Params     []float32
+	ParamNames []ParamName
+	UGens      []UGen
+	Variants   []Variant
+}
+
+// ParamName maps a control name to its first slot in Params
+type ParamName struct {
+	Name  string
+	Index int
+}
+
+// UGen is one node of the synthdef's unit generator graph
+type UGen struct {
+	Class        string
+	Rate         Rate
+	SpecialIndex int16
+	Inputs       []Input
+	Outputs      []Rate
+}
+
+// Input points either at another UGen's output or, when UGen is -1,
+// at an entry in the constants table
+type Input struct {
+	UGen   int
+	Output int
+}
+
+// IsConstant reports whether the input reads from the constants table
+func (in Input) IsConstant() bool {
+	return in.UGen == -1
+}
+
+// Variant is a named set of alternative parameter values
+type Variant struct {
+	Name   string
+	Params []float32
+}
+
+// Control describes a named parameter. Array controls span several
+// consecutive slots, which is why defaults are a slice.
+type Control struct {
+	Name     string    `json:"name"`
+	Index    int       `json:"index"`
+	Defaults []float32 `json:"defaults"`
+}
+
+// ParseFile reads and parses the .scsyndef file at path
+func ParseFile(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	file, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// Parse reads a complete SCgf stream
+func Parse(r io.Reader) (*File, error) {
+	p := &parser{r: bufio.NewReader(r)}
+
+	var magic [4]byte
+	p.read(&magic)
+	if p.err == nil && string(magic[:]) != "SCgf" {
+		return nil, fmt.Errorf("bad magic %q, not a synthdef file", magic[:])
+	}
+
+	var version int32
+	p.read(&version)
+	if p.err == nil && version != 1 && version != 2 {
+		return nil, fmt.Errorf("unsupported synthdef version %d", version)
+	}
+	p.version = int(version)
+
+	var numDefs int16
+	p.read(&numDefs)
+	if p.err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", p.err)
+	}
+
+	file := &File{Version: p.version}
+	for i := 0; i < int(numDefs); i++ {
+		def := p.synthDef()
+		if p.err != nil {
+			return nil, fmt.Errorf("failed to read synthdef %d: %w", i, p.err)
+		}
+		file.Defs = append(file.Defs, def)
+	}
+
+	return file, nil
+}
+
+// parser carries the first error so the field-by-field reads stay linear;
+// every read after a failure is a no-op
+type parser struct {
+	r       *bufio.Reader
+	version int
+	err     error
+}
+
+func (p *parser) read(v interface{}) {
+	if p.err != nil {
+		return
+	}
+	p.err = binary.Read(p.r, binary.BigEndian, v)
+}
+
+// v1 stores counts and indices as int16, v2 widened them to int32
+func (p *parser) count() int {
+	if p.version >= 2 {
+		var n int32
+		p.read(&n)
+		return int(n)
+	}
+	var n int16
+	p.read(&n)
+	return int(n)
+}
+
+// the biggest defs sclang writes hold a few thousand of anything, so this
+// only stops a corrupt count from allocating gigabytes
+const maxCount = 1 << 20
+
+// counts come from untrusted files, so refuse anything negative or absurd
+// before it reaches make()
+func (p *parser) size(what string) int {
+	n := p.count()
+	if p.err == nil && (n < 0 || n > maxCount) {
+		p.err = fmt.Errorf("%s count %d out of range", what, n)
+	}
+	if p.err != nil {
+		return 0
+	}
+	return n
+}
+
+func (p *parser) pstring() string {
+	if p.err != nil {
+		return ""
+	}
+	size, err := p.r.ReadByte()
+	if err != nil {
+		p.err = err
+		return ""
+	}
+	buf := make([]byte, size)
+	_, p.err = io.ReadFull(p.r, buf)
+	return string(buf)
+}
+
+func (p *parser) floats(n int) []float32 {
+	values := make([]float32, n)
+	p.read(values)
+	return values
+}
+
+func (p *parser) synthDef() *SynthDef {
+	def := &SynthDef{Name: p.pstring()}
+
+	def.Constants = p.floats(p.size("constant"))
+	def.Params = p.floats(p.size("parameter"))
+
+	numNames := p.size("parameter name")
+	for i := 0; i < numNames && p.err == nil; i++ {
+		name := p.pstring()
+		index := p.count()
+		def.ParamNames = append(def.ParamNames, ParamName{Name: name, Index: index})
+	}
+
+	numUGens := p.size("ugen")
+	for i := 0; i < numUGens && p.err == nil; i++ {
+		def.UGens = append(def.UGens, p.ugen())
+	}
+
+	var numVariants int16
+	p.read(&numVariants)
+	for i := 0; i < int(numVariants) && p.err == nil; i++ {
+		name := p.pstring()
+		def.Variants = append(def.Variants, Variant{Name: name, Params: p.floats(len(def.Params))})
+	}
+
+	if p.err == nil {
+		p.err = def.validate()
+	}
+	return def
+}
+
+func (p *parser) ugen() UGen {
+	u := UGen{Class: p.pstring()}
+
+	var rate int8
+	p.read(&rate)
+	u.Rate = Rate(rate)
+
+	numInputs := p.size("input")
+	numOutputs := p.size("output")
+	p.read(&u.SpecialIndex)
+
+	for i := 0; i < numInputs && p.err == nil; i++ {
+		ugen := p.count()
+		output := p.count()
+		u.Inputs = append(u.Inputs, Input{UGen: ugen, Output: output})
+	}
+
+	for i := 0; i < numOutputs && p.err == nil; i++ {
+		var outRate int8
+		p.read(&outRate)
+		u.Outputs = append(u.Outputs, Rate(outRate))
+	}
+
+	return u
+}
+
+// validate checks the graph references so consumers can index freely
+func (d *SynthDef) validate() error {
+	for _, pn := range d.ParamNames {
+		if pn.Index < 0 || pn.Index >= len(d.Params) {
+			return fmt.Errorf("parameter %q index %d out of range", pn.Name, pn.Index)
+		}
+	}
+
+	for i, u := range d.UGens {
+		for _, in := range u.Inputs {
+			if in.IsConstant() {
+				if in.Output < 0 || in.Output >= len(d.Constants) {
+					return fmt.Errorf("ugen %d (%s) references missing constant %d", i, u.Class, in.Output)
+				}
+				continue
+			}
+			// the graph is topologically sorted, so inputs always
+			// point backwards
+			if in.UGen < 0 || in.UGen >= i {
+				return fmt.Errorf("ugen %d (%s) references invalid ugen %d", i, u.Class, in.UGen)
+			}
+			if in.Output < 0 || in.Output >= len(d.UGens[in.UGen].Outputs) {
+				return fmt.Errorf("ugen %d (%s) references missing output %d of ugen %d", i, u.Class, in.Output, in.UGen)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Controls returns the named parameters ordered by slot, each carrying
+// every default value up to the next named parameter
+func (d *SynthDef) Controls() []Control {
+	controls := make([]Control, 0, len(d.ParamNames))
+	for _, pn := range d.ParamNames {
+		controls = append(controls, Control{Name: pn.Name, Index: pn.Index})
+	}
+	sort.Slice(controls, func(i, j int) bool { return controls[i].Index < controls[j].Index })
+
+	for i := range controls {
+		end := len(d.Params)
+		if i+1 < len(controls) {
+			end = controls[i+1].Index
+		}
+		if end < controls[i].Index {
+			end = controls[i].Index
+		}
+		controls[i].Defaults = append([]float32(nil), d.Params[controls[i].Index:end]...)
+	}
+
+	return controls
+}
+
+// outputUGens lists the UGens that write to buses, with the number of
+// leading non-signal inputs each one takes
+var outputUGens = map[string]int{
+	"Out":        1, // bus
+	"OffsetOut":  1, // bus
+	"ReplaceOut": 1, // bus
+	"XOut":       2, // bus, xfade
+}
+
+// NumOutputChannels returns the widest multichannel write to an output bus.
+// LocalOut is deliberately ignored since it only feeds LocalIn.
+func (d *SynthDef) NumOutputChannels() int {
+	channels := 0
+	for _, u := range d.UGens {
+		skip, ok := outputUGens[u.Class]
+		if !ok {
+			continue
+		}
+		if n := len(u.Inputs) - skip; n > channels {
+			channels = n
+		}
+	}
+	return channels
+}
@@ -0,0 +1,276 @@
+package scsyndef
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writer encodes SCgf the way sclang does, so fixtures stay readable as
+// SynthDef values instead of byte dumps
+type writer struct {
+	version int
+	buf     bytes.Buffer
+}
+
+func (w *writer) put(v interface{}) {
+	binary.Write(&w.buf, binary.BigEndian, v)
+}
+
+func (w *writer) count(n int) {
+	if w.version >= 2 {
+		w.put(int32(n))
+		return
+	}
+	w.put(int16(n))
+}
+
+func (w *writer) pstring(s string) {
+	w.buf.WriteByte(byte(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *writer) header(numDefs int) {
+	w.buf.WriteString("SCgf")
+	w.put(int32(w.version))
+	w.put(int16(numDefs))
+}
+
+func encode(version int, defs ...*SynthDef) []byte {
+	w := &writer{version: version}
+	w.header(len(defs))
+	for _, d := range defs {
+		w.pstring(d.Name)
+		w.count(len(d.Constants))
+		w.put(d.Constants)
+		w.count(len(d.Params))
+		w.put(d.Params)
+
+		w.count(len(d.ParamNames))
+		for _, pn := range d.ParamNames {
+			w.pstring(pn.Name)
+			w.count(pn.Index)
+		}
+
+		w.count(len(d.UGens))
+		for _, u := range d.UGens {
+			w.pstring(u.Class)
+			w.put(int8(u.Rate))
+			w.count(len(u.Inputs))
+			w.count(len(u.Outputs))
+			w.put(u.SpecialIndex)
+			for _, in := range u.Inputs {
+				w.count(in.UGen)
+				w.count(in.Output)
+			}
+			for _, rate := range u.Outputs {
+				w.put(int8(rate))
+			}
+		}
+
+		w.put(int16(len(d.Variants)))
+		for _, v := range d.Variants {
+			w.pstring(v.Name)
+			w.put(v.Params)
+		}
+	}
+	return w.buf.Bytes()
+}
+
+// a panned sine, roughly what
+//
+//	SynthDef(\sine, { |freq = 440, amp = 0.1, pos = #[0.5, 0.5]| ... })
+//
+// compiles to. Names are out of slot order, as sclang may write them.
+func sineDef() *SynthDef {
+	return &SynthDef{
+		Name:      "sine",
+		Constants: []float32{0},
+		Params:    []float32{440, 0.1, 0.5, 0.5},
+		ParamNames: []ParamName{
+			{Name: "amp", Index: 1},
+			{Name: "freq", Index: 0},
+			{Name: "pos", Index: 2},
+		},
+		UGens: []UGen{
+			{Class: "Control", Rate: RateControl, Outputs: []Rate{RateControl, RateControl, RateControl, RateControl}},
+			{Class: "SinOsc", Rate: RateAudio, Inputs: []Input{{UGen: 0, Output: 0}, {UGen: -1, Output: 0}}, Outputs: []Rate{RateAudio}},
+			{Class: "BinaryOpUGen", Rate: RateAudio, SpecialIndex: 2, Inputs: []Input{{UGen: 1, Output: 0}, {UGen: 0, Output: 1}}, Outputs: []Rate{RateAudio}},
+			{Class: "Out", Rate: RateAudio, Inputs: []Input{{UGen: -1, Output: 0}, {UGen: 2, Output: 0}, {UGen: 2, Output: 0}}},
+		},
+		Variants: []Variant{{Name: "low", Params: []float32{220, 0.2, 0.5, 0.5}}},
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, version := range []int{1, 2} {
+		file, err := Parse(bytes.NewReader(encode(version, sineDef())))
+		if err != nil {
+			t.Fatalf("v%d: Parse: %v", version, err)
+		}
+		if file.Version != version {
+			t.Errorf("v%d: version = %d", version, file.Version)
+		}
+		if len(file.Defs) != 1 {
+			t.Fatalf("v%d: got %d defs, want 1", version, len(file.Defs))
+		}
+		if got := file.Defs[0]; !reflect.DeepEqual(got, sineDef()) {
+			t.Errorf("v%d: parsed %+v\nwant %+v", version, got, sineDef())
+		}
+	}
+}
+
+func TestControls(t *testing.T) {
+	want := []Control{
+		{Name: "freq", Index: 0, Defaults: []float32{440}},
+		{Name: "amp", Index: 1, Defaults: []float32{0.1}},
+		{Name: "pos", Index: 2, Defaults: []float32{0.5, 0.5}},
+	}
+	if got := sineDef().Controls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Controls() = %+v, want %+v", got, want)
+	}
+}
+
+func TestNumOutputChannels(t *testing.T) {
+	def := sineDef()
+	if got := def.NumOutputChannels(); got != 2 {
+		t.Errorf("NumOutputChannels() = %d, want 2", got)
+	}
+
+	// LocalOut feeds LocalIn, not a bus
+	def.UGens[3].Class = "LocalOut"
+	if got := def.NumOutputChannels(); got != 0 {
+		t.Errorf("NumOutputChannels() with LocalOut = %d, want 0", got)
+	}
+}
+
+func TestParseRejectsBadHeader(t *testing.T) {
+	valid := encode(2, sineDef())
+
+	badMagic := append([]byte("SCgg"), valid[4:]...)
+	if _, err := Parse(bytes.NewReader(badMagic)); err == nil || !strings.Contains(err.Error(), "bad magic") {
+		t.Errorf("bad magic: error = %v", err)
+	}
+
+	w := &writer{version: 3}
+	w.header(0)
+	if _, err := Parse(bytes.NewReader(w.buf.Bytes())); err == nil || !strings.Contains(err.Error(), "unsupported synthdef version 3") {
+		t.Errorf("version 3: error = %v", err)
+	}
+}
+
+func TestParseTruncated(t *testing.T) {
+	for _, version := range []int{1, 2} {
+		data := encode(version, sineDef())
+		for n := 0; n < len(data); n++ {
+			if _, err := Parse(bytes.NewReader(data[:n])); err == nil {
+				t.Errorf("v%d: parsed the first %d of %d bytes without an error", version, n, len(data))
+			}
+		}
+	}
+}
+
+func TestParseRejectsOversizedCounts(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		// written after the def's name, in place of the constant count
+		write   func(w *writer)
+		wantErr string
+	}{
+		{
+			name:    "constants past the cap",
+			version: 2,
+			write:   func(w *writer) { w.count(maxCount + 1) },
+			wantErr: "constant count 1048577 out of range",
+		},
+		{
+			name:    "constants near 2^31",
+			version: 2,
+			write:   func(w *writer) { w.count(1<<31 - 1) },
+			wantErr: "constant count 2147483647 out of range",
+		},
+		{
+			name:    "negative v1 count",
+			version: 1,
+			write:   func(w *writer) { w.count(-1) },
+			wantErr: "constant count -1 out of range",
+		},
+		{
+			name:    "ugen inputs past the cap",
+			version: 2,
+			write: func(w *writer) {
+				w.count(0) // constants
+				w.count(0) // params
+				w.count(0) // param names
+				w.count(1) // ugens
+				w.pstring("SinOsc")
+				w.put(int8(RateAudio))
+				w.count(maxCount + 1)
+			},
+			wantErr: "input count 1048577 out of range",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &writer{version: tt.version}
+			w.header(1)
+			w.pstring("huge")
+			tt.write(w)
+
+			_, err := Parse(bytes.NewReader(w.buf.Bytes()))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseRejectsInvalidGraph(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(d *SynthDef)
+		wantErr string
+	}{
+		{
+			name:    "parameter past the end",
+			mutate:  func(d *SynthDef) { d.ParamNames[2].Index = 4 },
+			wantErr: `parameter "pos" index 4 out of range`,
+		},
+		{
+			name:    "missing constant",
+			mutate:  func(d *SynthDef) { d.UGens[1].Inputs[1].Output = 1 },
+			wantErr: "ugen 1 (SinOsc) references missing constant 1",
+		},
+		{
+			name:    "forward reference",
+			mutate:  func(d *SynthDef) { d.UGens[1].Inputs[0].UGen = 2 },
+			wantErr: "ugen 1 (SinOsc) references invalid ugen 2",
+		},
+		{
+			name:    "self reference",
+			mutate:  func(d *SynthDef) { d.UGens[2].Inputs[0].UGen = 2 },
+			wantErr: "ugen 2 (BinaryOpUGen) references invalid ugen 2",
+		},
+		{
+			name:    "missing output",
+			mutate:  func(d *SynthDef) { d.UGens[2].Inputs[1].Output = 4 },
+			wantErr: "ugen 2 (BinaryOpUGen) references missing output 4 of ugen 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def := sineDef()
+			tt.mutate(def)
+
+			_, err := Parse(bytes.NewReader(encode(2, def)))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,12 +2,15 @@ package session
 
 import (
 	"log"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/pion/webrtc/v3"
 
 	gst "github.com/po-studio/server/internal/gstreamer-src"
+	"github.com/po-studio/server/jack"
+	sc "github.com/po-studio/server/supercollider"
 	"github.com/po-studio/server/synth"
 )
 
@@ -15,12 +18,38 @@ type AppSession struct {
 	Id                string
 	PeerConnection    *webrtc.PeerConnection
 	GStreamerPipeline *gst.Pipeline
+	AudioTrack        *webrtc.TrackLocalStaticSample
 	Synth             synth.Synth
 	AudioSrc          *string
 	SynthPort         int
 	JackClientName    string
+	SynthDefName      string
+	InitialParams     sc.ControlValues
+	EncodingProfile   *EncodingProfile
+	Playlist          *Playlist
+	Events            *EventBus
 	MonitorDone       chan struct{}
 	monitorClosed     atomic.Value
+	playlistMu        sync.Mutex
+	pipelineMu        sync.Mutex
+	pipelineRestarts  []time.Time
+	bitrateMu         sync.Mutex
+	bitrate           *BitrateController
+	bitrateDone       chan struct{}
+	recordingMu       sync.Mutex
+	recording         *Recording
+	candidatesMu      sync.Mutex
+	candidates        *CandidateBuffer
+}
+
+// InitSynth creates the session's synth, wired to report its JACK client
+// name and engine events back to the session
+func (as *AppSession) InitSynth() {
+	as.Synth = synth.NewSuperColliderSynth(as.Id)
+	as.Synth.SetOnClientName(func(clientName string) {
+		as.JackClientName = clientName
+	})
+	as.Synth.SetOnEvent(as.Publish)
 }
 
 func (as *AppSession) StopAllProcesses() {
@@ -35,13 +64,24 @@ func (as *AppSession) StopAllProcesses() {
 		as.MonitorDone = nil
 	}
 
-	// Stop GStreamer before SuperCollider to prevent port disconnection race
-	if as.GStreamerPipeline != nil {
-		log.Printf("[%s] Stopping GStreamer pipeline", as.Id)
-		as.GStreamerPipeline.Stop()
-		as.GStreamerPipeline = nil
+	as.StopBitrateControl()
+
+	// Finalize any recording while the pipeline can still carry its EOS
+	if info, err := as.StopRecording(); err == nil {
+		log.Printf("[%s] Finalized recording %s", as.Id, info.Id)
+	}
+
+	// Stop the playlist scheduler before the synth it drives goes away
+	as.StopPlaylist()
+
+	// Disconnect only the JACK ports this session owns
+	if err := jack.DisconnectSession(as.Id); err != nil {
+		log.Printf("[%s] Error disconnecting JACK ports: %v", as.Id, err)
 	}
 
+	// Stop GStreamer before SuperCollider to prevent port disconnection race
+	as.StopPipeline()
+
 	// Stop synth for this session only
 	if as.Synth != nil {
 		log.Printf("[%s] Stopping synth engine", as.Id)
@@ -97,6 +137,10 @@ func (as *AppSession) StopAllProcesses() {
 	// Reset monitoring state
 	as.monitorClosed.Store(false)
 
+	// Ports are gone now, so drop our claims before another session's
+	// scsynth reuses a client name
+	jack.ReleaseSession(as.Id)
+
 	log.Printf("[%s] Cleanup completed - Resources freed: Synth=%v, PeerConnection=%v, GStreamer=%v",
 		as.Id,
 		as.Synth == nil,
@@ -0,0 +1,270 @@
+package session
+
+import (
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	gst "github.com/po-studio/server/internal/gstreamer-src"
+)
+
+// EventBitrate is published when the controller retunes the encoder
+const EventBitrate = "bitrate"
+
+const (
+	bitrateControlInterval = time.Second
+
+	// lowest bitrate we'll step down to; opus stays intelligible here
+	minOpusBitrate = 16000
+
+	// loss-based control from the gcc draft: back off above 10% loss,
+	// probe upwards below 2%, hold in between
+	bitrateHighLoss     = 0.10
+	bitrateLowLoss      = 0.02
+	bitrateIncreaseRate = 1.05
+	// probing up on a long rtt just builds queues
+	bitrateMaxProbeRTT = 400 * time.Millisecond
+
+	// weight of the newest report in the smoothed loss
+	bitrateLossSmoothing = 0.5
+	// turn on fec once smoothed loss reaches this, even if the profile
+	// leaves it off
+	bitrateFECLoss = 0.01
+	// skip retuning for changes smaller than this fraction
+	bitrateMinChange = 0.04
+)
+
+// NetworkReport is the receiver's view of our audio stream, taken from its
+// RTCP receiver reports. Counters are cumulative.
+type NetworkReport struct {
+	PacketsReceived uint64
+	PacketsLost     int64
+	RoundTripTime   time.Duration
+}
+
+// BitrateStats is the controller's current state for clients
+type BitrateStats struct {
+	TargetBitrate        int       `json:"target_bitrate"`
+	MinBitrate           int       `json:"min_bitrate"`
+	MaxBitrate           int       `json:"max_bitrate"`
+	PacketLossPercentage int       `json:"packet_loss_percentage"`
+	FEC                  bool      `json:"fec"`
+	FractionLost         float64   `json:"fraction_lost"`
+	RoundTripTimeMs      float64   `json:"round_trip_time_ms"`
+	UpdatedAt            time.Time `json:"updated_at,omitempty"`
+}
+
+// why we need a bitrate controller:
+// - listeners on poor networks got dropouts at a fixed bitrate
+// - the receiver already tells us its loss and rtt in rtcp reports
+// - opusenc picks up bitrate, fec and expected loss without a restart
+type BitrateController struct {
+	mu      sync.Mutex
+	profile EncodingProfile
+	min     int
+	target  int
+	loss    float64
+	rtt     time.Duration
+	last    NetworkReport
+	seen    bool
+	updated time.Time
+
+	// what the encoder was last told
+	appliedBitrate int
+	appliedLoss    int
+	appliedFEC     bool
+}
+
+func newBitrateController(profile EncodingProfile) *BitrateController {
+	floor := minOpusBitrate
+	if profile.Bitrate < floor {
+		floor = profile.Bitrate
+	}
+	return &BitrateController{
+		profile:        profile,
+		min:            floor,
+		target:         profile.Bitrate,
+		appliedBitrate: profile.Bitrate,
+		appliedLoss:    profile.PacketLossPercentage,
+		appliedFEC:     profile.FEC,
+	}
+}
+
+// update folds in a receiver report and returns true when the encoder
+// should be retuned
+func (c *BitrateController) update(report NetworkReport, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	received := int64(report.PacketsReceived) - int64(c.last.PacketsReceived)
+	lost := report.PacketsLost - c.last.PacketsLost
+	seen := c.seen
+	c.last = report
+	c.seen = true
+	// counters only move when a new report arrives
+	if !seen || received+lost <= 0 {
+		return false
+	}
+	if lost < 0 {
+		// duplicates can push the cumulative count backwards
+		lost = 0
+	}
+
+	interval := float64(lost) / float64(received+lost)
+	c.loss = bitrateLossSmoothing*interval + (1-bitrateLossSmoothing)*c.loss
+	if report.RoundTripTime > 0 {
+		c.rtt = report.RoundTripTime
+	}
+	c.updated = now
+
+	target := c.target
+	switch {
+	case interval > bitrateHighLoss:
+		target = int(float64(target) * (1 - 0.5*interval))
+	case interval < bitrateLowLoss && c.rtt < bitrateMaxProbeRTT:
+		target = int(float64(target) * bitrateIncreaseRate)
+	}
+	if target < c.min {
+		target = c.min
+	}
+	if target > c.profile.Bitrate {
+		target = c.profile.Bitrate
+	}
+	c.target = target
+
+	lossPercent, fec := c.resilienceLocked()
+	change := math.Abs(float64(target-c.appliedBitrate)) / float64(c.appliedBitrate)
+	// always land exactly on the ceiling or floor
+	atLimit := target != c.appliedBitrate && (target == c.min || target == c.profile.Bitrate)
+	if change < bitrateMinChange && !atLimit && lossPercent == c.appliedLoss && fec == c.appliedFEC {
+		return false
+	}
+
+	c.appliedBitrate = target
+	c.appliedLoss = lossPercent
+	c.appliedFEC = fec
+	return true
+}
+
+// callers must hold c.mu
+func (c *BitrateController) resilienceLocked() (int, bool) {
+	lossPercent := int(math.Round(c.loss * 100))
+	if lossPercent < c.profile.PacketLossPercentage {
+		lossPercent = c.profile.PacketLossPercentage
+	}
+	if lossPercent > 100 {
+		lossPercent = 100
+	}
+	return lossPercent, c.profile.FEC || c.loss >= bitrateFECLoss
+}
+
+// settings returns what the encoder should currently be running with
+func (c *BitrateController) settings() (bitrate, packetLossPercentage int, fec bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.appliedBitrate, c.appliedLoss, c.appliedFEC
+}
+
+// Stats returns a snapshot of the controller
+func (c *BitrateController) Stats() BitrateStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return BitrateStats{
+		TargetBitrate:        c.appliedBitrate,
+		MinBitrate:           c.min,
+		MaxBitrate:           c.profile.Bitrate,
+		PacketLossPercentage: c.appliedLoss,
+		FEC:                  c.appliedFEC,
+		FractionLost:         c.loss,
+		RoundTripTimeMs:      float64(c.rtt) / float64(time.Millisecond),
+		UpdatedAt:            c.updated,
+	}
+}
+
+// StartBitrateControl polls report for the receiver's view of the stream
+// and retunes the running encoder to match. report returns false until
+// the first receiver report arrives. A session reused by a later offer
+// starts over from that offer's profile.
+func (as *AppSession) StartBitrateControl(report func() (NetworkReport, bool)) {
+	as.bitrateMu.Lock()
+	defer as.bitrateMu.Unlock()
+
+	if as.bitrateDone != nil {
+		close(as.bitrateDone)
+	}
+	as.bitrate = newBitrateController(as.Encoding())
+	as.bitrateDone = make(chan struct{})
+	go as.runBitrateControl(as.bitrate, report, as.bitrateDone)
+}
+
+// StopBitrateControl stops polling and forgets the controller. The
+// running encoder keeps its last settings; a rebuilt one gets the profile's.
+func (as *AppSession) StopBitrateControl() {
+	as.bitrateMu.Lock()
+	defer as.bitrateMu.Unlock()
+
+	if as.bitrateDone != nil {
+		close(as.bitrateDone)
+		as.bitrateDone = nil
+	}
+	as.bitrate = nil
+}
+
+// BitrateStats returns the controller's state, or nil before it starts
+func (as *AppSession) BitrateStats() *BitrateStats {
+	as.bitrateMu.Lock()
+	controller := as.bitrate
+	as.bitrateMu.Unlock()
+
+	if controller == nil {
+		return nil
+	}
+	stats := controller.Stats()
+	return &stats
+}
+
+func (as *AppSession) runBitrateControl(controller *BitrateController, report func() (NetworkReport, bool), done chan struct{}) {
+	ticker := time.NewTicker(bitrateControlInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		r, ok := report()
+		if !ok || !controller.update(r, time.Now()) {
+			continue
+		}
+
+		bitrate, lossPercent, fec := controller.settings()
+		as.pipelineMu.Lock()
+		if as.GStreamerPipeline != nil {
+			if err := as.GStreamerPipeline.SetOpusEncoder(bitrate, lossPercent, fec); err != nil {
+				log.Printf("[%s][BITRATE] Failed to retune encoder: %v", as.Id, err)
+			}
+		}
+		as.pipelineMu.Unlock()
+
+		log.Printf("[%s][BITRATE] Encoder now %d bps, expected loss %d%%, fec=%v", as.Id, bitrate, lossPercent, fec)
+		as.Publish(EventBitrate, controller.Stats())
+	}
+}
+
+// opusOptions is the session's profile adjusted by the controller, so a
+// restarted pipeline comes back at the current target
+func (as *AppSession) opusOptions() gst.OpusOptions {
+	opts := as.Encoding().OpusOptions()
+
+	as.bitrateMu.Lock()
+	controller := as.bitrate
+	as.bitrateMu.Unlock()
+
+	if controller != nil {
+		opts.Bitrate, opts.PacketLossPercentage, opts.FEC = controller.settings()
+	}
+	return opts
+}
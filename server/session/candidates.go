@@ -0,0 +1,78 @@
+package session
+
+import (
+	"sync"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// why server candidates are buffered rather than published as events:
+// - gathering starts before the client has opened a stream to receive them
+// - EventSource reconnects on its own and has to pick up where it left off
+type CandidateBuffer struct {
+	mu         sync.Mutex
+	candidates []webrtc.ICECandidateInit
+	complete   bool
+	// closed and replaced whenever a candidate arrives or gathering ends
+	changed chan struct{}
+}
+
+func newCandidateBuffer() *CandidateBuffer {
+	return &CandidateBuffer{changed: make(chan struct{})}
+}
+
+// Add records a gathered candidate
+func (b *CandidateBuffer) Add(candidate webrtc.ICECandidateInit) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.complete {
+		return
+	}
+	b.candidates = append(b.candidates, candidate)
+	b.notifyLocked()
+}
+
+// Complete marks gathering as finished
+func (b *CandidateBuffer) Complete() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.complete {
+		return
+	}
+	b.complete = true
+	b.notifyLocked()
+}
+
+func (b *CandidateBuffer) notifyLocked() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// Since returns the candidates after the first n, whether gathering has
+// finished, and a channel that closes when either changes
+func (b *CandidateBuffer) Since(n int) ([]webrtc.ICECandidateInit, bool, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var candidates []webrtc.ICECandidateInit
+	if n < len(b.candidates) {
+		candidates = append(candidates, b.candidates[n:]...)
+	}
+	return candidates, b.complete, b.changed
+}
+
+// ResetLocalCandidates starts a fresh buffer for a new peer connection
+func (as *AppSession) ResetLocalCandidates() *CandidateBuffer {
+	as.candidatesMu.Lock()
+	defer as.candidatesMu.Unlock()
+	as.candidates = newCandidateBuffer()
+	return as.candidates
+}
+
+// LocalCandidates returns the current peer connection's server candidates,
+// or nil before one has been attached
+func (as *AppSession) LocalCandidates() *CandidateBuffer {
+	as.candidatesMu.Lock()
+	defer as.candidatesMu.Unlock()
+	return as.candidates
+}
@@ -0,0 +1,82 @@
+package session
+
+import (
+	"time"
+
+	sc "github.com/po-studio/server/supercollider"
+)
+
+// Publish sends an event to everyone subscribed to this session
+func (as *AppSession) Publish(eventType string, data interface{}) {
+	if as.Events == nil {
+		return
+	}
+	as.Events.Publish(Event{
+		Type:      eventType,
+		SessionId: as.Id,
+		Time:      time.Now(),
+		Data:      data,
+	})
+}
+
+// PublishError notifies subscribers of a failure they didn't directly cause,
+// e.g. a playlist entry that couldn't start
+func (as *AppSession) PublishError(err error) {
+	as.Publish(EventError, map[string]string{"message": err.Error()})
+}
+
+// NowPlaying returns what the session's synth is currently playing
+func (as *AppSession) NowPlaying() (NowPlaying, error) {
+	if as.Synth == nil {
+		return NowPlaying{}, sc.ErrNoActiveSynth
+	}
+	params, err := as.Synth.GetParams()
+	if err != nil {
+		return NowPlaying{}, err
+	}
+	return NowPlaying{Synth: as.Synth.ActiveSynthDef(), Params: params}, nil
+}
+
+func (as *AppSession) publishNowPlaying() {
+	if nowPlaying, err := as.NowPlaying(); err == nil {
+		as.Publish(EventNowPlaying, nowPlaying)
+	}
+}
+
+// PlaySynth starts the session's first synth node, picking a random def
+// when none was requested
+func (as *AppSession) PlaySynth() error {
+	if as.Synth == nil {
+		return sc.ErrNoActiveSynth
+	}
+	if err := as.Synth.SendPlayMessage(as.SynthDefName, as.InitialParams); err != nil {
+		return err
+	}
+	as.publishNowPlaying()
+	return nil
+}
+
+// SetSynthParams changes controls on the running node and tells subscribers
+func (as *AppSession) SetSynthParams(params sc.ControlValues) (sc.ControlValues, error) {
+	if as.Synth == nil {
+		return nil, sc.ErrNoActiveSynth
+	}
+	current, err := as.Synth.SetParams(params)
+	if err != nil {
+		return nil, err
+	}
+	as.Publish(EventParams, current)
+	return current, nil
+}
+
+// SwitchSynth crossfades to another synthdef and tells subscribers
+func (as *AppSession) SwitchSynth(synthDefName string, params sc.ControlValues, crossfade time.Duration) error {
+	if as.Synth == nil {
+		return sc.ErrNoActiveSynth
+	}
+	if err := as.Synth.SwitchSynth(synthDefName, params, crossfade); err != nil {
+		return err
+	}
+	as.publishNowPlaying()
+	return nil
+}
@@ -0,0 +1,144 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	gst "github.com/po-studio/server/internal/gstreamer-src"
+)
+
+// DefaultEncodingProfile is used when an offer doesn't ask for one
+const DefaultEncodingProfile = "standard"
+
+// ErrUnknownEncodingProfile is returned for a profile name we don't define
+var ErrUnknownEncodingProfile = errors.New("unknown encoding profile")
+
+// EncodingProfile is a named set of Opus encoder settings. The same
+// settings are advertised in the SDP answer so the browser's decoder
+// agrees with what the pipeline actually sends.
+type EncodingProfile struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Channels    int    `json:"channels"`
+	Bitrate     int    `json:"bitrate"`
+	FEC         bool   `json:"fec"`
+	DTX         bool   `json:"dtx"`
+	// expected loss, tells the encoder how much fec redundancy to add
+	PacketLossPercentage int     `json:"packet_loss_percentage,omitempty"`
+	FrameSize            float64 `json:"frame_size"`
+	Complexity           int     `json:"complexity"`
+}
+
+// why we need named profiles:
+// - phones on cellular can't sustain 128k stereo, installations want more
+// - clients pick by name instead of tuning encoder internals
+// - keeps the set of encoder configurations we support small and tested
+var encodingProfiles = map[string]EncodingProfile{
+	"low": {
+		Name:                 "low",
+		Description:          "mono 32 kbps with fec and dtx, for constrained networks",
+		Channels:             1,
+		Bitrate:              32000,
+		FEC:                  true,
+		DTX:                  true,
+		PacketLossPercentage: 10,
+		FrameSize:            20,
+		Complexity:           10,
+	},
+	"standard": {
+		Name:        "standard",
+		Description: "stereo 128 kbps",
+		Channels:    2,
+		Bitrate:     128000,
+		FrameSize:   20,
+		Complexity:  10,
+	},
+	"hifi": {
+		Name:                 "hifi",
+		Description:          "stereo 510 kbps with fec and dtx",
+		Channels:             2,
+		Bitrate:              510000,
+		FEC:                  true,
+		DTX:                  true,
+		PacketLossPercentage: 5,
+		FrameSize:            20,
+		Complexity:           10,
+	},
+}
+
+// LookupEncodingProfile returns the named profile, or the default for ""
+func LookupEncodingProfile(name string) (EncodingProfile, error) {
+	if name == "" {
+		name = DefaultEncodingProfile
+	}
+	profile, ok := encodingProfiles[name]
+	if !ok {
+		return EncodingProfile{}, fmt.Errorf("%w: %q", ErrUnknownEncodingProfile, name)
+	}
+	return profile, nil
+}
+
+// EncodingProfiles lists every profile, sorted by bitrate
+func EncodingProfiles() []EncodingProfile {
+	profiles := make([]EncodingProfile, 0, len(encodingProfiles))
+	for _, profile := range encodingProfiles {
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Bitrate < profiles[j].Bitrate
+	})
+	return profiles
+}
+
+// OpusOptions converts the profile to encoder settings
+func (p EncodingProfile) OpusOptions() gst.OpusOptions {
+	return gst.OpusOptions{
+		Channels:             p.Channels,
+		Bitrate:              p.Bitrate,
+		FrameSize:            p.FrameSize,
+		Complexity:           p.Complexity,
+		FEC:                  p.FEC,
+		PacketLossPercentage: p.PacketLossPercentage,
+		DTX:                  p.DTX,
+	}
+}
+
+// SDPFmtpLine is the Opus fmtp for this profile (RFC 7587). stereo asks the
+// browser to decode both channels, sprop-stereo says we'll send them.
+func (p EncodingProfile) SDPFmtpLine() string {
+	stereo := 0
+	if p.Channels == 2 {
+		stereo = 1
+	}
+
+	params := []string{
+		"minptime=10",
+		fmt.Sprintf("useinbandfec=%d", boolParam(p.FEC)),
+		fmt.Sprintf("stereo=%d", stereo),
+		fmt.Sprintf("sprop-stereo=%d", stereo),
+		fmt.Sprintf("maxaveragebitrate=%d", p.Bitrate),
+	}
+	if p.DTX {
+		params = append(params, "usedtx=1")
+	}
+	return strings.Join(params, ";")
+}
+
+func boolParam(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Encoding returns the session's encoding profile, falling back to the
+// default when none was chosen
+func (as *AppSession) Encoding() EncodingProfile {
+	if as.EncodingProfile != nil {
+		return *as.EncodingProfile
+	}
+	profile, _ := LookupEncodingProfile(DefaultEncodingProfile)
+	return profile
+}
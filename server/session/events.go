@@ -0,0 +1,83 @@
+package session
+
+import (
+	"sync"
+	"time"
+
+	sc "github.com/po-studio/server/supercollider"
+)
+
+// event types pushed to session subscribers
+const (
+	EventNowPlaying = "now_playing"
+	EventParams     = "params"
+	EventError      = "error"
+	// forwarded from the synth engine
+	EventEngineHealth    = sc.EventEngineHealth
+	EventEngineRestarted = sc.EventEngineRestarted
+	EventEngineFailed    = sc.EventEngineFailed
+)
+
+// Event is a notification about something that happened in a session
+type Event struct {
+	Type      string      `json:"type"`
+	SessionId string      `json:"session_id"`
+	Time      time.Time   `json:"time"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// NowPlaying is the payload of now_playing events
+type NowPlaying struct {
+	Synth  string      `json:"synth"`
+	Params interface{} `json:"params,omitempty"`
+}
+
+// why we need a per-session event bus:
+// - the data channel, metering and future consumers all want the same events
+// - publishers shouldn't know who is listening
+// - a slow subscriber must never stall audio control paths
+type EventBus struct {
+	mu          sync.Mutex
+	subscribers map[int]chan Event
+	nextId      int
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[int]chan Event)}
+}
+
+// Subscribe returns a channel of events and a function that unsubscribes
+// and closes it
+func (b *EventBus) Subscribe(buffer int) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextId
+	b.nextId++
+	ch := make(chan Event, buffer)
+	b.subscribers[id] = ch
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subscribers, id)
+			close(ch)
+		})
+	}
+}
+
+// Publish delivers an event to every subscriber, dropping it for any
+// subscriber whose buffer is full
+func (b *EventBus) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
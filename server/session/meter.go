@@ -0,0 +1,170 @@
+package session
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	gst "github.com/po-studio/server/internal/gstreamer-src"
+)
+
+// EventLevels and EventAudioAlarm are published by the session's Meter
+const (
+	EventLevels     = "levels"
+	EventAudioAlarm = "audio_alarm"
+)
+
+// alarm kinds carried by audio_alarm events
+const (
+	AlarmSilence  = "silence"
+	AlarmClipping = "clipping"
+)
+
+const (
+	// level reports -inf for digital silence, which json can't encode
+	meterFloorDb = -100.0
+	// a stream quieter than this on every channel counts as silent
+	silenceThresholdDb = -60.0
+	// how long a stream must stay silent before we alarm
+	silenceAlarmAfter = 5 * time.Second
+	// peaks at or above this count as clipping
+	clippingThresholdDb = -0.1
+	// how long without a clipped peak before the clipping alarm clears
+	clippingHold = 2 * time.Second
+)
+
+// Levels is the payload of levels events. All values are dBFS.
+type Levels struct {
+	RMS      []float64 `json:"rms"`
+	Peak     []float64 `json:"peak"`
+	Spectrum []float32 `json:"spectrum,omitempty"`
+}
+
+// AudioAlarm is the payload of audio_alarm events, sent when an alarm
+// starts and again when it clears
+type AudioAlarm struct {
+	Kind   string  `json:"kind"`
+	Active bool    `json:"active"`
+	PeakDb float64 `json:"peak_db"`
+}
+
+// why we meter on the server:
+// - the client visualizer should show what we actually send, not a guess
+// - a silent or clipping synth is invisible from packet counters alone
+// - the level and spectrum elements are pass-through, so the stream is untouched
+type Meter struct {
+	mu       sync.Mutex
+	session  *AppSession
+	spectrum []float32
+
+	quietSince  time.Time
+	silent      bool
+	lastClipped time.Time
+	clipping    bool
+}
+
+// AttachMeter hooks the session's meter up to a pipeline built by
+// buildGstreamerPipeline. Must be called before the pipeline starts.
+func (as *AppSession) AttachMeter(pipeline *gst.Pipeline) {
+	meter := &Meter{session: as}
+	pipeline.OnSpectrum(meter.handleSpectrum)
+	pipeline.OnLevel(meter.handleLevel)
+}
+
+func (m *Meter) handleSpectrum(magnitudes []float32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spectrum = magnitudes
+}
+
+// level and spectrum post on the same interval, so each level reading
+// goes out with the latest spectrum
+func (m *Meter) handleLevel(level gst.Level) {
+	levels := Levels{
+		RMS:  clampDb(level.RMS),
+		Peak: clampDb(level.Peak),
+	}
+
+	m.mu.Lock()
+	levels.Spectrum = m.spectrum
+	alarms := m.checkAlarms(maxDb(levels.Peak), time.Now())
+	m.mu.Unlock()
+
+	m.session.Publish(EventLevels, levels)
+	for _, alarm := range alarms {
+		if alarm.Active {
+			log.Printf("[%s][METER] %s alarm raised (peak %.1f dB)", m.session.Id, alarm.Kind, alarm.PeakDb)
+		} else {
+			log.Printf("[%s][METER] %s alarm cleared", m.session.Id, alarm.Kind)
+		}
+		m.session.Publish(EventAudioAlarm, alarm)
+	}
+}
+
+// checkAlarms returns the alarms that changed state. Callers must hold m.mu.
+func (m *Meter) checkAlarms(peak float64, now time.Time) []AudioAlarm {
+	var changed []AudioAlarm
+
+	if peak < silenceThresholdDb {
+		if m.quietSince.IsZero() {
+			m.quietSince = now
+		}
+		if !m.silent && now.Sub(m.quietSince) >= silenceAlarmAfter {
+			m.silent = true
+			changed = append(changed, AudioAlarm{Kind: AlarmSilence, Active: true, PeakDb: peak})
+		}
+	} else {
+		m.quietSince = time.Time{}
+		if m.silent {
+			m.silent = false
+			changed = append(changed, AudioAlarm{Kind: AlarmSilence, Active: false, PeakDb: peak})
+		}
+	}
+
+	if peak >= clippingThresholdDb {
+		m.lastClipped = now
+		if !m.clipping {
+			m.clipping = true
+			changed = append(changed, AudioAlarm{Kind: AlarmClipping, Active: true, PeakDb: peak})
+		}
+	} else if m.clipping && now.Sub(m.lastClipped) >= clippingHold {
+		m.clipping = false
+		changed = append(changed, AudioAlarm{Kind: AlarmClipping, Active: false, PeakDb: peak})
+	}
+
+	return changed
+}
+
+func clampDb(values []float64) []float64 {
+	clamped := make([]float64, len(values))
+	for i, v := range values {
+		if math.IsNaN(v) || v < meterFloorDb {
+			v = meterFloorDb
+		}
+		clamped[i] = v
+	}
+	return clamped
+}
+
+func maxDb(values []float64) float64 {
+	max := meterFloorDb
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// meterElements returns the pass-through metering stage for the session
+// pipeline. level and spectrum post element messages on the bus every
+// interval; the encoder downstream sees the audio unchanged.
+func meterElements(interval time.Duration, bands int) []string {
+	return []string{
+		fmt.Sprintf("level name=level interval=%d post-messages=true", interval.Nanoseconds()),
+		fmt.Sprintf("spectrum name=spectrum bands=%d interval=%d threshold=%d post-messages=true message-magnitude=true",
+			bands, interval.Nanoseconds(), int(meterFloorDb)),
+	}
+}
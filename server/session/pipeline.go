@@ -0,0 +1,137 @@
+package session
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+
+	gst "github.com/po-studio/server/internal/gstreamer-src"
+	"github.com/po-studio/server/jack"
+)
+
+// pipeline events published to session subscribers
+const (
+	EventPipeline          = "pipeline"
+	EventPipelineRestarted = "pipeline_restarted"
+	EventPipelineFailed    = "pipeline_failed"
+)
+
+const (
+	pipelineRestartDelay = time.Second
+	// at most maxPipelineRestarts within pipelineRestartWindow, after
+	// which the pipeline stays down
+	maxPipelineRestarts   = 3
+	pipelineRestartWindow = 5 * time.Minute
+)
+
+// StartPipeline builds the session's GStreamer pipeline around track and
+// starts it
+func (as *AppSession) StartPipeline(track *webrtc.TrackLocalStaticSample) error {
+	as.pipelineMu.Lock()
+	defer as.pipelineMu.Unlock()
+	return as.startPipelineLocked(track)
+}
+
+// callers must hold as.pipelineMu
+func (as *AppSession) startPipelineLocked(track *webrtc.TrackLocalStaticSample) error {
+	pipeline := gst.CreateOpusPipeline([]*webrtc.TrackLocalStaticSample{track}, *as.AudioSrc, as.opusOptions())
+	if pipeline == nil {
+		return fmt.Errorf("failed to create pipeline")
+	}
+
+	// jackaudiosrc is named after the session in buildGstreamerPipeline
+	jack.ClaimSource(as.Id, as.Id)
+
+	as.AttachMeter(pipeline)
+	pipeline.OnBusMessage(func(msg gst.BusMessage) {
+		as.handleBusMessage(pipeline, msg)
+	})
+
+	as.AudioTrack = track
+	as.GStreamerPipeline = pipeline
+	pipeline.Start()
+	return nil
+}
+
+// StopPipeline stops the session's pipeline, if any
+func (as *AppSession) StopPipeline() {
+	as.pipelineMu.Lock()
+	defer as.pipelineMu.Unlock()
+
+	if as.GStreamerPipeline != nil {
+		log.Printf("[%s] Stopping GStreamer pipeline", as.Id)
+		as.GStreamerPipeline.Stop()
+		as.GStreamerPipeline = nil
+	}
+}
+
+// runs on the glib main loop, so anything slow goes to a goroutine
+func (as *AppSession) handleBusMessage(pipeline *gst.Pipeline, msg gst.BusMessage) {
+	switch msg.Type {
+	case gst.BusError, gst.BusEOS:
+		as.Publish(EventPipeline, msg)
+		go as.restartPipeline(pipeline, msg)
+	case gst.BusWarning:
+		as.Publish(EventPipeline, msg)
+	}
+}
+
+// why we restart just this pipeline:
+// - one session's failed pipeline used to exit the whole server
+// - the peer connection and track survive, so a new pipeline can feed them
+// - scsynth keeps running and only needs rewiring to the new jack ports
+func (as *AppSession) restartPipeline(failed *gst.Pipeline, cause gst.BusMessage) {
+	as.pipelineMu.Lock()
+	defer as.pipelineMu.Unlock()
+
+	// already replaced, or the session is shutting down
+	if as.GStreamerPipeline != failed {
+		return
+	}
+
+	failed.Stop()
+	as.GStreamerPipeline = nil
+
+	if !as.allowPipelineRestart(time.Now()) {
+		log.Printf("[%s][PIPELINE] Giving up after %d restarts in %v", as.Id, maxPipelineRestarts, pipelineRestartWindow)
+		as.Publish(EventPipelineFailed, cause)
+		return
+	}
+
+	time.Sleep(pipelineRestartDelay)
+	log.Printf("[%s][PIPELINE] Restarting pipeline after %s", as.Id, cause.Type)
+
+	if err := as.startPipelineLocked(as.AudioTrack); err != nil {
+		log.Printf("[%s][PIPELINE] Restart failed: %v", as.Id, err)
+		as.Publish(EventPipelineFailed, cause)
+		return
+	}
+
+	if as.Synth != nil {
+		if err := as.Synth.ConnectOutputs(); err != nil {
+			log.Printf("[%s][PIPELINE] Failed to reconnect synth: %v", as.Id, err)
+			as.PublishError(fmt.Errorf("pipeline restarted but synth could not be reconnected: %w", err))
+		}
+	}
+
+	as.Publish(EventPipelineRestarted, cause)
+}
+
+// callers must hold as.pipelineMu
+func (as *AppSession) allowPipelineRestart(now time.Time) bool {
+	recent := as.pipelineRestarts[:0]
+	for _, t := range as.pipelineRestarts {
+		if now.Sub(t) < pipelineRestartWindow {
+			recent = append(recent, t)
+		}
+	}
+	as.pipelineRestarts = recent
+
+	if len(as.pipelineRestarts) >= maxPipelineRestarts {
+		return false
+	}
+	as.pipelineRestarts = append(as.pipelineRestarts, now)
+	return true
+}
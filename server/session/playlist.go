@@ -0,0 +1,332 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	sc "github.com/po-studio/server/supercollider"
+)
+
+// how long to wait before moving on when an entry fails to start,
+// so a broken def can't spin the scheduler
+const playlistRetryDelay = 5 * time.Second
+
+// ErrNoPlaylist is returned when a playlist operation targets a session
+// that isn't running one
+var ErrNoPlaylist = errors.New("no playlist running")
+
+// PlaylistEntry is one synthdef in a playlist
+type PlaylistEntry struct {
+	Synth  string           `json:"synth"`
+	Params sc.ControlValues `json:"params,omitempty"`
+	// how long the entry plays, in seconds, counted from the start of
+	// its crossfade in
+	Duration float64 `json:"duration"`
+	// crossfade in from the previous entry, in seconds; defaults to
+	// sc.DefaultCrossfade
+	Crossfade *float64 `json:"crossfade,omitempty"`
+}
+
+func (e PlaylistEntry) duration() time.Duration {
+	return time.Duration(e.Duration * float64(time.Second))
+}
+
+func (e PlaylistEntry) crossfade() time.Duration {
+	if e.Crossfade == nil {
+		return sc.DefaultCrossfade
+	}
+	return time.Duration(*e.Crossfade * float64(time.Second))
+}
+
+func (e PlaylistEntry) validate() error {
+	if e.Synth == "" {
+		return fmt.Errorf("entry is missing a synth")
+	}
+	if e.Duration <= 0 {
+		return fmt.Errorf("entry %s needs a positive duration", e.Synth)
+	}
+	if c := e.crossfade(); c < 0 || c > sc.MaxCrossfade || c > e.duration() {
+		return fmt.Errorf("%w: entry %s crossfade must be between 0 and min(%v, duration)", sc.ErrInvalidCrossfade, e.Synth, sc.MaxCrossfade)
+	}
+	return sc.ValidateSynthRequest(e.Synth, e.Params)
+}
+
+// PlaylistStatus is a snapshot of a playlist for clients
+type PlaylistStatus struct {
+	Entries   []PlaylistEntry `json:"entries"`
+	Current   int             `json:"current"`
+	Shuffle   bool            `json:"shuffle"`
+	Loop      bool            `json:"loop"`
+	StartedAt time.Time       `json:"started_at"`
+	Remaining float64         `json:"remaining"`
+}
+
+// why we need a per-session playlist:
+// - installations run for hours without a client driving them
+// - each entry crossfades in through the same path as /synth/switch
+// - one goroutine per session keeps scheduling simple to stop
+type Playlist struct {
+	mu        sync.Mutex
+	session   *AppSession
+	entries   []PlaylistEntry
+	current   int
+	shuffle   bool
+	loop      bool
+	startedAt time.Time
+	deadline  time.Time
+	// a non-looping playlist that ran out; its scheduler has exited, so
+	// it takes no more changes
+	finished bool
+
+	skip    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// ValidatePlaylistEntries checks every entry up front so a bad entry is
+// rejected when queued rather than hours later when it comes up
+func ValidatePlaylistEntries(entries []PlaylistEntry) error {
+	for i, entry := range entries {
+		if err := entry.validate(); err != nil {
+			return fmt.Errorf("entry %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func newPlaylist(as *AppSession, entries []PlaylistEntry, shuffle, loop bool) *Playlist {
+	p := &Playlist{
+		session: as,
+		entries: append([]PlaylistEntry(nil), entries...),
+		current: -1,
+		shuffle: shuffle,
+		loop:    loop,
+		skip:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if shuffle {
+		p.shuffleEntries()
+	}
+	return p
+}
+
+// callers must hold p.mu
+func (p *Playlist) shuffleEntries() {
+	rand.Shuffle(len(p.entries), func(i, j int) {
+		p.entries[i], p.entries[j] = p.entries[j], p.entries[i]
+	})
+}
+
+// advance moves to the next entry, wrapping (and reshuffling) when looping.
+// Returns false once a non-looping playlist runs out.
+func (p *Playlist) advance() (PlaylistEntry, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	next := p.current + 1
+	if next >= len(p.entries) {
+		if !p.loop || len(p.entries) == 0 {
+			p.finished = true
+			return PlaylistEntry{}, false
+		}
+		if p.shuffle {
+			p.shuffleEntries()
+		}
+		next = 0
+	}
+
+	p.current = next
+	p.startedAt = time.Now()
+	p.deadline = p.startedAt.Add(p.entries[next].duration())
+	return p.entries[next], true
+}
+
+func (p *Playlist) run() {
+	defer close(p.stopped)
+
+	for {
+		entry, ok := p.advance()
+		if !ok {
+			log.Printf("[PLAYLIST] Playlist finished")
+			return
+		}
+
+		wait := entry.duration()
+		if err := p.session.SwitchSynth(entry.Synth, entry.Params, entry.crossfade()); err != nil {
+			log.Printf("[PLAYLIST][ERROR] Failed to start %s: %v", entry.Synth, err)
+			p.session.PublishError(fmt.Errorf("playlist entry %s failed to start: %w", entry.Synth, err))
+			wait = playlistRetryDelay
+		} else {
+			log.Printf("[PLAYLIST] Now playing %s for %v", entry.Synth, wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-p.done:
+			timer.Stop()
+			return
+		case <-p.skip:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// Queue appends entries to the end of the playlist
+func (p *Playlist) Queue(entries []PlaylistEntry) error {
+	if err := ValidatePlaylistEntries(entries); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.finished {
+		return ErrNoPlaylist
+	}
+	p.entries = append(p.entries, entries...)
+	return nil
+}
+
+// Skip cuts the current entry short and crossfades to the next one
+func (p *Playlist) Skip() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.finished {
+		return ErrNoPlaylist
+	}
+
+	select {
+	case p.skip <- struct{}{}:
+	default:
+		// a skip is already pending
+	}
+	return nil
+}
+
+// Reorder rearranges the entries. order must be a permutation of the
+// current indices; the playing entry keeps playing at its new position.
+func (p *Playlist) Reorder(order []int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.finished {
+		return ErrNoPlaylist
+	}
+
+	if len(order) != len(p.entries) {
+		return fmt.Errorf("order has %d indices, playlist has %d entries", len(order), len(p.entries))
+	}
+
+	seen := make([]bool, len(order))
+	reordered := make([]PlaylistEntry, len(order))
+	newCurrent := -1
+	for i, idx := range order {
+		if idx < 0 || idx >= len(p.entries) || seen[idx] {
+			return fmt.Errorf("order must be a permutation of 0..%d", len(p.entries)-1)
+		}
+		seen[idx] = true
+		reordered[i] = p.entries[idx]
+		if idx == p.current {
+			newCurrent = i
+		}
+	}
+
+	p.entries = reordered
+	p.current = newCurrent
+	return nil
+}
+
+// Status returns a snapshot of the playlist
+func (p *Playlist) Status() PlaylistStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := PlaylistStatus{
+		Entries:   append([]PlaylistEntry(nil), p.entries...),
+		Current:   p.current,
+		Shuffle:   p.shuffle,
+		Loop:      p.loop,
+		StartedAt: p.startedAt,
+	}
+	if remaining := time.Until(p.deadline); remaining > 0 {
+		status.Remaining = remaining.Seconds()
+	}
+	return status
+}
+
+func (p *Playlist) isFinished() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.finished
+}
+
+// Stop ends the scheduler and waits for it to exit. The current synth
+// keeps playing; stopping audio is up to the caller.
+func (p *Playlist) Stop() {
+	p.mu.Lock()
+	select {
+	case <-p.done:
+	default:
+		close(p.done)
+	}
+	p.mu.Unlock()
+	<-p.stopped
+}
+
+// StartPlaylist replaces any running playlist with a new one and starts
+// its scheduler
+func (as *AppSession) StartPlaylist(entries []PlaylistEntry, shuffle, loop bool) (*Playlist, error) {
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("playlist needs at least one entry")
+	}
+	if err := ValidatePlaylistEntries(entries); err != nil {
+		return nil, err
+	}
+	if as.Synth == nil {
+		return nil, sc.ErrNoActiveSynth
+	}
+
+	as.playlistMu.Lock()
+	defer as.playlistMu.Unlock()
+
+	if as.Playlist != nil {
+		as.Playlist.Stop()
+	}
+
+	as.Playlist = newPlaylist(as, entries, shuffle, loop)
+	go as.Playlist.run()
+
+	log.Printf("[%s][PLAYLIST] Started playlist with %d entries (shuffle=%v, loop=%v)", as.Id, len(entries), shuffle, loop)
+	return as.Playlist, nil
+}
+
+// GetPlaylist returns the running playlist, if any. One that played to
+// the end is dropped; start a new one to keep going.
+func (as *AppSession) GetPlaylist() (*Playlist, error) {
+	as.playlistMu.Lock()
+	defer as.playlistMu.Unlock()
+
+	if as.Playlist != nil && as.Playlist.isFinished() {
+		as.Playlist = nil
+	}
+	if as.Playlist == nil {
+		return nil, ErrNoPlaylist
+	}
+	return as.Playlist, nil
+}
+
+// StopPlaylist stops the scheduler, leaving the current synth playing
+func (as *AppSession) StopPlaylist() {
+	as.playlistMu.Lock()
+	defer as.playlistMu.Unlock()
+
+	if as.Playlist != nil {
+		log.Printf("[%s][PLAYLIST] Stopping playlist", as.Id)
+		as.Playlist.Stop()
+		as.Playlist = nil
+	}
+}
@@ -0,0 +1,336 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/po-studio/server/config"
+	gst "github.com/po-studio/server/internal/gstreamer-src"
+)
+
+// EventRecording is published when a recording starts and when it's finalized
+const EventRecording = "recording"
+
+// why a recording can end
+const (
+	RecordingStopped         = "stopped"
+	RecordingMaxDuration     = "max_duration"
+	RecordingPipelineStopped = "pipeline_stopped"
+)
+
+// how long to wait for EOS to finalize the file before giving up on it
+const recordingFinalizeTimeout = 5 * time.Second
+
+// how many events the timeline can fall behind before params are dropped
+const recordingEventBuffer = 64
+
+var (
+	ErrRecordingActive   = errors.New("a recording is already running")
+	ErrNoRecording       = errors.New("no recording running")
+	ErrRecordingNotFound = errors.New("recording not found")
+	ErrNoPipeline        = errors.New("no pipeline running")
+)
+
+// ParamChange is one entry in a recording's params timeline
+type ParamChange struct {
+	// seconds since the recording started
+	Offset float64     `json:"offset"`
+	Synth  string      `json:"synth,omitempty"`
+	Params interface{} `json:"params,omitempty"`
+}
+
+// RecordingInfo is a recording's metadata, kept next to the audio as
+// <id>.json
+type RecordingInfo struct {
+	Id        string              `json:"id"`
+	SessionId string              `json:"session_id"`
+	Format    gst.RecordingFormat `json:"format"`
+	File      string              `json:"file"`
+	SynthDef  string              `json:"synthdef,omitempty"`
+	Timeline  []ParamChange       `json:"timeline"`
+	StartedAt time.Time           `json:"started_at"`
+	EndedAt   *time.Time          `json:"ended_at,omitempty"`
+	Duration  float64             `json:"duration"`
+	Size      int64               `json:"size"`
+	EndReason string              `json:"end_reason,omitempty"`
+}
+
+// Finished reports whether the file has been finalized
+func (info RecordingInfo) Finished() bool {
+	return info.EndedAt != nil
+}
+
+// why recordings capture a timeline as well as audio:
+// - a listener's session is shaped by knob turns and synth switches
+// - the file alone can't tell you what was playing when
+type Recording struct {
+	mu       sync.Mutex
+	info     RecordingInfo
+	dir      string
+	branch   *gst.Recording
+	stop     chan struct{}
+	stopOnce sync.Once
+	finished chan struct{}
+}
+
+// Info returns a snapshot of the recording's metadata
+func (r *Recording) Info() RecordingInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info := r.info
+	info.Timeline = append([]ParamChange(nil), r.info.Timeline...)
+	if !info.Finished() {
+		info.Duration = time.Since(info.StartedAt).Seconds()
+	}
+	return info
+}
+
+func (r *Recording) addChange(change ParamChange) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	change.Offset = time.Since(r.info.StartedAt).Seconds()
+	if change.Synth != "" {
+		r.info.SynthDef = change.Synth
+	}
+	r.info.Timeline = append(r.info.Timeline, change)
+}
+
+func (r *Recording) requestStop() {
+	r.stopOnce.Do(func() { close(r.stop) })
+}
+
+func (r *Recording) writeSidecar() error {
+	data, err := json.MarshalIndent(r.Info(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(r.dir, r.info.Id+".json"), data, 0644)
+}
+
+func newRecordingId() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b)
+}
+
+// StartRecording writes the session's audio to the recordings directory
+// until StopRecording, the configured max duration, or the pipeline stops
+func (as *AppSession) StartRecording(formatName string) (*Recording, error) {
+	format, err := gst.ParseRecordingFormat(formatName)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := config.Get()
+	if err := os.MkdirAll(cfg.RecordingsDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create recordings directory: %w", err)
+	}
+
+	as.recordingMu.Lock()
+	defer as.recordingMu.Unlock()
+	if as.recording != nil {
+		return nil, ErrRecordingActive
+	}
+
+	id := newRecordingId()
+	file := id + "." + format.Extension()
+
+	as.pipelineMu.Lock()
+	if as.GStreamerPipeline == nil {
+		as.pipelineMu.Unlock()
+		return nil, ErrNoPipeline
+	}
+	branch, err := as.GStreamerPipeline.StartRecording(format, filepath.Join(cfg.RecordingsDir, file))
+	as.pipelineMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	recording := &Recording{
+		info: RecordingInfo{
+			Id:        id,
+			SessionId: as.Id,
+			Format:    format,
+			File:      file,
+			Timeline:  []ParamChange{},
+			StartedAt: time.Now(),
+		},
+		dir:      cfg.RecordingsDir,
+		branch:   branch,
+		stop:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+
+	// subscribe before reading what's playing so no change slips between
+	events, unsubscribe := as.Events.Subscribe(recordingEventBuffer)
+	if nowPlaying, err := as.NowPlaying(); err == nil {
+		recording.addChange(ParamChange{Synth: nowPlaying.Synth, Params: nowPlaying.Params})
+	}
+	if err := recording.writeSidecar(); err != nil {
+		log.Printf("[%s][RECORDING] Failed to write metadata: %v", as.Id, err)
+	}
+
+	as.recording = recording
+	go as.runRecording(recording, events, unsubscribe, cfg.MaxRecording)
+
+	log.Printf("[%s][RECORDING] Started %s recording %s", as.Id, format, id)
+	as.Publish(EventRecording, recording.Info())
+	return recording, nil
+}
+
+func (as *AppSession) runRecording(recording *Recording, events <-chan Event, unsubscribe func(), maxDuration time.Duration) {
+	defer close(recording.finished)
+	defer unsubscribe()
+
+	timer := time.NewTimer(maxDuration)
+	defer timer.Stop()
+
+	reason := RecordingStopped
+loop:
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			switch event.Type {
+			case EventNowPlaying:
+				if nowPlaying, ok := event.Data.(NowPlaying); ok {
+					recording.addChange(ParamChange{Synth: nowPlaying.Synth, Params: nowPlaying.Params})
+				}
+			case EventParams:
+				recording.addChange(ParamChange{Params: event.Data})
+			}
+		case <-recording.stop:
+			break loop
+		case <-timer.C:
+			reason = RecordingMaxDuration
+			break loop
+		case <-recording.branch.Done():
+			reason = RecordingPipelineStopped
+			break loop
+		}
+	}
+
+	recording.branch.Stop()
+	select {
+	case <-recording.branch.Done():
+	case <-time.After(recordingFinalizeTimeout):
+		log.Printf("[%s][RECORDING] Timed out finalizing %s", as.Id, recording.info.Id)
+	}
+
+	now := time.Now()
+	recording.mu.Lock()
+	recording.info.EndedAt = &now
+	recording.info.Duration = now.Sub(recording.info.StartedAt).Seconds()
+	recording.info.EndReason = reason
+	if stat, err := os.Stat(filepath.Join(recording.dir, recording.info.File)); err == nil {
+		recording.info.Size = stat.Size()
+	}
+	recording.mu.Unlock()
+
+	if err := recording.writeSidecar(); err != nil {
+		log.Printf("[%s][RECORDING] Failed to write metadata: %v", as.Id, err)
+	}
+
+	as.recordingMu.Lock()
+	if as.recording == recording {
+		as.recording = nil
+	}
+	as.recordingMu.Unlock()
+
+	log.Printf("[%s][RECORDING] Finished %s (%s)", as.Id, recording.info.Id, reason)
+	as.Publish(EventRecording, recording.Info())
+}
+
+// GetRecording returns the session's running recording, if any
+func (as *AppSession) GetRecording() (*Recording, error) {
+	as.recordingMu.Lock()
+	defer as.recordingMu.Unlock()
+
+	if as.recording == nil {
+		return nil, ErrNoRecording
+	}
+	return as.recording, nil
+}
+
+// StopRecording finalizes the running recording and returns its metadata
+func (as *AppSession) StopRecording() (RecordingInfo, error) {
+	recording, err := as.GetRecording()
+	if err != nil {
+		return RecordingInfo{}, err
+	}
+
+	recording.requestStop()
+	<-recording.finished
+	return recording.Info(), nil
+}
+
+// ListRecordings returns finished and running recordings, newest first.
+// An empty sessionId lists every session's recordings.
+func ListRecordings(sessionId string) ([]RecordingInfo, error) {
+	dir := config.Get().RecordingsDir
+	sidecars, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	recordings := []RecordingInfo{}
+	for _, sidecar := range sidecars {
+		info, err := readRecordingInfo(sidecar)
+		if err != nil {
+			log.Printf("[RECORDING] Skipping %s: %v", sidecar, err)
+			continue
+		}
+		if sessionId == "" || info.SessionId == sessionId {
+			recordings = append(recordings, info)
+		}
+	}
+
+	sort.Slice(recordings, func(i, j int) bool {
+		return recordings[i].StartedAt.After(recordings[j].StartedAt)
+	})
+	return recordings, nil
+}
+
+// LookupRecording returns a recording's metadata and the path of its audio
+func LookupRecording(id string) (RecordingInfo, string, error) {
+	// ids come from urls; never let one escape the directory
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return RecordingInfo{}, "", ErrRecordingNotFound
+	}
+
+	dir := config.Get().RecordingsDir
+	info, err := readRecordingInfo(filepath.Join(dir, id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return RecordingInfo{}, "", ErrRecordingNotFound
+	}
+	if err != nil {
+		return RecordingInfo{}, "", err
+	}
+	return info, filepath.Join(dir, filepath.Base(info.File)), nil
+}
+
+func readRecordingInfo(path string) (RecordingInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RecordingInfo{}, err
+	}
+	var info RecordingInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return RecordingInfo{}, err
+	}
+	return info, nil
+}
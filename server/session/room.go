@@ -0,0 +1,237 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+
+	sc "github.com/po-studio/server/supercollider"
+)
+
+// EventListeners is published on a room's session when someone joins or leaves
+const EventListeners = "listeners"
+
+var (
+	ErrRoomNotFound     = errors.New("room not found")
+	ErrRoomClosed       = errors.New("room is closed")
+	ErrListenerNotFound = errors.New("listener not found")
+)
+
+var rooms = struct {
+	sync.Mutex
+	byId map[string]*Room
+}{byId: make(map[string]*Room)}
+
+// RoomOptions picks what a room plays and how it's encoded. Synth and
+// Params are optional, as with an offer.
+type RoomOptions struct {
+	Name    string           `json:"name,omitempty"`
+	Synth   string           `json:"synth,omitempty"`
+	Params  sc.ControlValues `json:"params,omitempty"`
+	Profile string           `json:"profile,omitempty"`
+}
+
+// RoomInfo is a room as the api reports it
+type RoomInfo struct {
+	Id         string      `json:"id"`
+	Name       string      `json:"name,omitempty"`
+	Profile    string      `json:"profile"`
+	NowPlaying *NowPlaying `json:"now_playing,omitempty"`
+	Listeners  int         `json:"listeners"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+// Listener is one peer connection attached to a room's track
+type Listener struct {
+	Id             string
+	PeerConnection *webrtc.PeerConnection
+	JoinedAt       time.Time
+}
+
+// why rooms share one engine:
+// - a broadcast should cost one scsynth and one encoder however many tune in
+// - TrackLocalStaticSample already fans samples out to every bound connection
+// - listeners come and go without touching the synth or the pipeline
+type Room struct {
+	Id        string
+	Name      string
+	Session   *AppSession
+	Track     *webrtc.TrackLocalStaticSample
+	CreatedAt time.Time
+
+	mu        sync.Mutex
+	listeners map[string]*Listener
+	closed    bool
+}
+
+// NewRoom registers a room whose engine session feeds track. The caller
+// starts the pipeline and synth, and closes the room if that fails.
+func NewRoom(opts RoomOptions, track *webrtc.TrackLocalStaticSample) (*Room, error) {
+	profile, err := LookupEncodingProfile(opts.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	id := newRoomId()
+	// the engine session is never registered with the session manager, so
+	// X-Session-ID can't reach the shared synth
+	appSession := newAppSession("room-" + id)
+	appSession.SynthDefName = opts.Synth
+	appSession.InitialParams = opts.Params
+	appSession.EncodingProfile = &profile
+
+	room := &Room{
+		Id:        id,
+		Name:      opts.Name,
+		Session:   appSession,
+		Track:     track,
+		CreatedAt: time.Now(),
+		listeners: make(map[string]*Listener),
+	}
+
+	rooms.Lock()
+	rooms.byId[id] = room
+	rooms.Unlock()
+
+	log.Printf("[ROOM][%s] Created room %q with %s profile", id, opts.Name, profile.Name)
+	return room, nil
+}
+
+// GetRoom looks up an open room
+func GetRoom(id string) (*Room, error) {
+	rooms.Lock()
+	defer rooms.Unlock()
+
+	room, ok := rooms.byId[id]
+	if !ok {
+		return nil, ErrRoomNotFound
+	}
+	return room, nil
+}
+
+// ListRooms returns every open room, oldest first
+func ListRooms() []RoomInfo {
+	rooms.Lock()
+	open := make([]*Room, 0, len(rooms.byId))
+	for _, room := range rooms.byId {
+		open = append(open, room)
+	}
+	rooms.Unlock()
+
+	sort.Slice(open, func(i, j int) bool { return open[i].CreatedAt.Before(open[j].CreatedAt) })
+
+	infos := make([]RoomInfo, 0, len(open))
+	for _, room := range open {
+		infos = append(infos, room.Info())
+	}
+	return infos
+}
+
+// Info returns a snapshot of the room
+func (r *Room) Info() RoomInfo {
+	info := RoomInfo{
+		Id:        r.Id,
+		Name:      r.Name,
+		Profile:   r.Session.Encoding().Name,
+		Listeners: r.ListenerCount(),
+		CreatedAt: r.CreatedAt,
+	}
+	if nowPlaying, err := r.Session.NowPlaying(); err == nil {
+		info.NowPlaying = &nowPlaying
+	}
+	return info
+}
+
+// ListenerCount returns how many peer connections are attached
+func (r *Room) ListenerCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.listeners)
+}
+
+// AddListener binds pc to the room's track. The caller negotiates pc and
+// removes the listener when the connection ends.
+func (r *Room) AddListener(pc *webrtc.PeerConnection) (*Listener, error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, ErrRoomClosed
+	}
+	if _, err := pc.AddTrack(r.Track); err != nil {
+		r.mu.Unlock()
+		return nil, err
+	}
+
+	listener := &Listener{
+		Id:             newRoomId(),
+		PeerConnection: pc,
+		JoinedAt:       time.Now(),
+	}
+	r.listeners[listener.Id] = listener
+	count := len(r.listeners)
+	r.mu.Unlock()
+
+	log.Printf("[ROOM][%s] Listener %s joined (%d listening)", r.Id, listener.Id, count)
+	r.Session.Publish(EventListeners, count)
+	return listener, nil
+}
+
+// RemoveListener detaches and closes one listener's connection, leaving
+// the room playing for everyone else
+func (r *Room) RemoveListener(id string) error {
+	r.mu.Lock()
+	listener, ok := r.listeners[id]
+	if !ok {
+		r.mu.Unlock()
+		return ErrListenerNotFound
+	}
+	delete(r.listeners, id)
+	count := len(r.listeners)
+	r.mu.Unlock()
+
+	if err := listener.PeerConnection.Close(); err != nil {
+		log.Printf("[ROOM][%s] Error closing listener %s: %v", r.Id, id, err)
+	}
+
+	log.Printf("[ROOM][%s] Listener %s left (%d listening)", r.Id, id, count)
+	r.Session.Publish(EventListeners, count)
+	return nil
+}
+
+// Close disconnects every listener and stops the room's synth and pipeline
+func (r *Room) Close() {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.closed = true
+	listeners := r.listeners
+	r.listeners = make(map[string]*Listener)
+	r.mu.Unlock()
+
+	rooms.Lock()
+	delete(rooms.byId, r.Id)
+	rooms.Unlock()
+
+	for id, listener := range listeners {
+		if err := listener.PeerConnection.Close(); err != nil {
+			log.Printf("[ROOM][%s] Error closing listener %s: %v", r.Id, id, err)
+		}
+	}
+
+	r.Session.StopAllProcesses()
+	log.Printf("[ROOM][%s] Closed after disconnecting %d listeners", r.Id, len(listeners))
+}
+
+func newRoomId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -1,6 +1,7 @@
 package session
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -8,7 +9,8 @@ import (
 	"strings"
 	"sync"
 
-	"github.com/po-studio/server/synth"
+	"github.com/po-studio/server/config"
+	gst "github.com/po-studio/server/internal/gstreamer-src"
 )
 
 // NB: not scaleable, as we can't hold all these sessions in memory
@@ -17,6 +19,9 @@ var sessionManager = SessionManager{
 	Sessions: make(map[string]*AppSession),
 }
 
+// ErrSessionNotFound is returned by GetSession for unknown session ids
+var ErrSessionNotFound = errors.New("session not found")
+
 type SessionManager struct {
 	Sessions map[string]*AppSession
 	mutex    sync.Mutex
@@ -37,6 +42,41 @@ func GetOrCreateSession(r *http.Request, w http.ResponseWriter) (*AppSession, er
 	return appSession, nil
 }
 
+// GetSession looks up an existing session without creating one. The id may
+// also come from the session_id query parameter, since EventSource can't
+// set request headers.
+func GetSession(r *http.Request) (*AppSession, error) {
+	sessionID, ok := getSessionIDFromHeader(r)
+	if !ok {
+		sessionID = r.URL.Query().Get("session_id")
+	}
+	if sessionID == "" {
+		return nil, fmt.Errorf("no session ID provided")
+	}
+
+	appSession, exists := sessionManager.GetSession(sessionID)
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	return appSession, nil
+}
+
+// CreateSession registers a new session under id, for callers like WHEP
+// that mint the id themselves rather than taking X-Session-ID
+func CreateSession(id string) *AppSession {
+	return sessionManager.CreateSession(id)
+}
+
+// LookupSession finds a session by id rather than from a request
+func LookupSession(id string) (*AppSession, bool) {
+	return sessionManager.GetSession(id)
+}
+
+// DeleteSession forgets a session; stop its processes first
+func DeleteSession(id string) {
+	sessionManager.DeleteSession(id)
+}
+
 func getSessionIDFromHeader(r *http.Request) (string, bool) {
 	sessionID := r.Header.Get("X-Session-ID")
 	if sessionID == "" {
@@ -61,6 +101,13 @@ func buildGstreamerPipeline(id string) string {
 		"audio/x-raw,rate=48000,channels=2",
 	}
 
+	// Recordings branch off here, so they hear what the encoder hears
+	elements = append(elements, gst.RecordingElements()...)
+
+	// Metering taps the final format, right before the encoder
+	cfg := config.Get()
+	elements = append(elements, meterElements(cfg.MeterInterval, cfg.MeterSpectrumBands)...)
+
 	// Join elements with ' ! ' to create proper pipeline
 	return strings.Join(elements, " ! ")
 }
@@ -70,25 +117,29 @@ func (sm *SessionManager) CreateSession(id string) *AppSession {
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
 
+	appSession := newAppSession(id)
+	sm.Sessions[id] = appSession
+
+	log.Printf("[SESSION] Session %s created successfully with audio source and synth", id)
+	return appSession
+}
+
+// newAppSession builds a session's audio source and synth without
+// registering it, so rooms can own sessions clients can't address
+func newAppSession(id string) *AppSession {
 	appSession := &AppSession{}
 	appSession.Id = id
+	appSession.Events = NewEventBus()
 
 	audioSrcFlag := fmt.Sprintf("audio-src-%s", id)
 	audioSrcConfig := buildGstreamerPipeline(id)
 
 	appSession.AudioSrc = flag.String(audioSrcFlag, audioSrcConfig, "GStreamer audio pipeline")
-	appSession.Synth = synth.NewSuperColliderSynth(id)
-	appSession.Synth.SetOnClientName(func(clientName string) {
-		appSession.JackClientName = clientName
-	})
+	appSession.InitSynth()
 
 	log.Printf("[AUDIO] Configuring audio pipeline for session %s: %s", id, audioSrcConfig)
 
 	appSession.monitorClosed.Store(false)
-
-	sm.Sessions[id] = appSession
-
-	log.Printf("[SESSION] Session %s created successfully with audio source and synth", id)
 	return appSession
 }
 
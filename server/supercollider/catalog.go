@@ -0,0 +1,215 @@
+package supercollider
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/po-studio/server/scsyndef"
+	"github.com/po-studio/server/utils"
+)
+
+// CatalogEntry is the metadata we keep for one compiled synthdef
+type CatalogEntry struct {
+	Name           string             `json:"name"`
+	File           string             `json:"file"`
+	Version        int                `json:"version"`
+	Controls       []scsyndef.Control `json:"controls"`
+	ConstantCount  int                `json:"constant_count"`
+	UGenCount      int                `json:"ugen_count"`
+	OutputChannels int                `json:"output_channels"`
+	Variants       []string           `json:"variants,omitempty"`
+	ModTime        time.Time          `json:"mod_time"`
+	// how the def measured when it was generated, nil for hand-written defs
+	Quality *QualityReport `json:"quality,omitempty"`
+
+	qualityModTime time.Time
+}
+
+// why we need a synthdef catalog:
+// - file names alone say nothing about what a def accepts
+// - param validation and the ui need real control metadata
+// - generated defs show up at runtime, so entries refresh lazily
+type Catalog struct {
+	dir     string
+	mu      sync.RWMutex
+	entries map[string]*CatalogEntry
+}
+
+var (
+	defaultCatalog     *Catalog
+	defaultCatalogOnce sync.Once
+
+	generatedCatalog     *Catalog
+	generatedCatalogErr  error
+	generatedCatalogOnce sync.Once
+)
+
+// NewCatalog creates an empty catalog backed by dir
+func NewCatalog(dir string) *Catalog {
+	return &Catalog{
+		dir:     dir,
+		entries: make(map[string]*CatalogEntry),
+	}
+}
+
+// DefaultCatalog returns the catalog for the synthdef directory scsynth loads from
+func DefaultCatalog() *Catalog {
+	defaultCatalogOnce.Do(func() {
+		defaultCatalog = NewCatalog(utils.SCSynthDefDirectory)
+	})
+	return defaultCatalog
+}
+
+// GeneratedCatalog returns the catalog for the directory SaveSynthDef
+// compiles to, where generated defs wait for the quality gate
+func GeneratedCatalog() (*Catalog, error) {
+	generatedCatalogOnce.Do(func() {
+		var dir string
+		if dir, generatedCatalogErr = GeneratedSynthDefDirectory(); generatedCatalogErr == nil {
+			generatedCatalog = NewCatalog(dir)
+		}
+	})
+	return generatedCatalog, generatedCatalogErr
+}
+
+// Refresh rescans the directory, reparsing only files that changed since
+// the last scan and dropping entries whose files are gone
+func (c *Catalog) Refresh() error {
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read synthdef directory %s: %w", c.dir, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	seen := make(map[string]bool, len(files))
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".scsyndef" {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+
+		path := filepath.Join(c.dir, file.Name())
+		name := strings.TrimSuffix(file.Name(), ".scsyndef")
+		seen[name] = true
+
+		// the quality report is written separately, so it's tracked on its own
+		var qualityModTime time.Time
+		if stat, err := os.Stat(qualityReportPath(c.dir, name)); err == nil {
+			qualityModTime = stat.ModTime()
+		}
+
+		if existing, ok := c.entries[name]; ok && existing.ModTime.Equal(info.ModTime()) &&
+			existing.qualityModTime.Equal(qualityModTime) {
+			continue
+		}
+
+		entry, err := loadCatalogEntry(path, name, info.ModTime())
+		if err != nil {
+			// a half-written or corrupt def shouldn't hide the rest
+			log.Printf("[CATALOG][WARNING] Skipping %s: %v", path, err)
+			delete(c.entries, name)
+			continue
+		}
+		if entry.Quality, err = loadQualityReport(c.dir, name); err != nil {
+			log.Printf("[CATALOG][WARNING] Ignoring quality report for %s: %v", name, err)
+		}
+		entry.qualityModTime = qualityModTime
+		c.entries[name] = entry
+	}
+
+	for name := range c.entries {
+		if !seen[name] {
+			delete(c.entries, name)
+		}
+	}
+
+	return nil
+}
+
+// Lookup returns the entry for a synthdef, rescanning once on a miss so
+// newly generated defs are found without a restart
+func (c *Catalog) Lookup(name string) (*CatalogEntry, error) {
+	c.mu.RLock()
+	entry, ok := c.entries[name]
+	c.mu.RUnlock()
+	if ok {
+		return entry, nil
+	}
+
+	if err := c.Refresh(); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if entry, ok := c.entries[name]; ok {
+		return entry, nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownSynthDef, name)
+}
+
+// List returns every entry sorted by name
+func (c *Catalog) List() ([]*CatalogEntry, error) {
+	if err := c.Refresh(); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entries := make([]*CatalogEntry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+func loadCatalogEntry(path, name string, modTime time.Time) (*CatalogEntry, error) {
+	file, err := scsyndef.ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(file.Defs) == 0 {
+		return nil, fmt.Errorf("no synthdefs in file")
+	}
+
+	// scsynth registers defs by their internal name, which normally
+	// matches the file name; fall back to the first def otherwise
+	def := file.Defs[0]
+	for _, d := range file.Defs {
+		if d.Name == name {
+			def = d
+			break
+		}
+	}
+
+	entry := &CatalogEntry{
+		Name:           name,
+		File:           path,
+		Version:        file.Version,
+		Controls:       def.Controls(),
+		ConstantCount:  len(def.Constants),
+		UGenCount:      len(def.UGens),
+		OutputChannels: def.NumOutputChannels(),
+		ModTime:        modTime,
+	}
+	for _, v := range def.Variants {
+		entry.Variants = append(entry.Variants, v.Name)
+	}
+
+	return entry, nil
+}
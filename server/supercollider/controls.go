@@ -0,0 +1,134 @@
+package supercollider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/hypebeast/go-osc/osc"
+	"github.com/po-studio/server/scsyndef"
+)
+
+// ErrNoActiveSynth is returned when a control change arrives before any
+// synth node has been started for the session
+var ErrNoActiveSynth = errors.New("no active synth")
+
+// ErrUnknownSynthDef is returned when a requested synthdef isn't in the catalog
+var ErrUnknownSynthDef = errors.New("unknown synthdef")
+
+// InvalidControlError reports a control that the active synthdef does not
+// declare, or a value that doesn't fit the declared control
+type InvalidControlError struct {
+	SynthDef string
+	Control  string
+	Reason   string
+}
+
+func (e *InvalidControlError) Error() string {
+	return fmt.Sprintf("invalid control %q for synthdef %s: %s", e.Control, e.SynthDef, e.Reason)
+}
+
+// ControlValue holds the value(s) of a single control. It accepts either a
+// JSON number or an array of numbers so that scalar knobs stay simple.
+type ControlValue []float32
+
+func (v *ControlValue) UnmarshalJSON(data []byte) error {
+	var single float32
+	if err := json.Unmarshal(data, &single); err == nil {
+		*v = ControlValue{single}
+		return nil
+	}
+
+	var many []float32
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("control value must be a number or an array of numbers")
+	}
+	*v = ControlValue(many)
+	return nil
+}
+
+func (v ControlValue) MarshalJSON() ([]byte, error) {
+	if len(v) == 1 {
+		return json.Marshal(v[0])
+	}
+	return json.Marshal([]float32(v))
+}
+
+// ControlValues maps control names to their values
+type ControlValues map[string]ControlValue
+
+// sortedNames keeps the OSC argument order stable between calls
+func (cv ControlValues) sortedNames() []string {
+	names := make([]string, 0, len(cv))
+	for name := range cv {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateParams checks params against the controls a synthdef declares
+func ValidateParams(synthDef string, controls []scsyndef.Control, params ControlValues) error {
+	declared := make(map[string]scsyndef.Control, len(controls))
+	for _, c := range controls {
+		declared[c.Name] = c
+	}
+
+	for _, name := range params.sortedNames() {
+		value := params[name]
+		control, ok := declared[name]
+		if !ok {
+			return &InvalidControlError{SynthDef: synthDef, Control: name, Reason: "not declared by synthdef"}
+		}
+		if len(value) == 0 {
+			return &InvalidControlError{SynthDef: synthDef, Control: name, Reason: "no value given"}
+		}
+		if len(value) > len(control.Defaults) {
+			return &InvalidControlError{
+				SynthDef: synthDef,
+				Control:  name,
+				Reason:   fmt.Sprintf("got %d values, control has %d slots", len(value), len(control.Defaults)),
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateSynthRequest checks that a synthdef exists and accepts params,
+// without touching any running synth
+func ValidateSynthRequest(synthDefName string, params ControlValues) error {
+	entry, err := DefaultCatalog().Lookup(synthDefName)
+	if err != nil {
+		return err
+	}
+	return ValidateParams(synthDefName, entry.Controls, params)
+}
+
+// controlMessages builds the /n_set (scalars) and /n_setn (arrays) messages
+// that apply params to a node, skipping whichever would be empty
+func controlMessages(nodeID int32, params ControlValues) []*osc.Message {
+	setMsg := osc.NewMessage("/n_set", nodeID)
+	setnMsg := osc.NewMessage("/n_setn", nodeID)
+
+	for _, name := range params.sortedNames() {
+		value := params[name]
+		if len(value) == 1 {
+			setMsg.Append(name, value[0])
+			continue
+		}
+		setnMsg.Append(name, int32(len(value)))
+		for _, v := range value {
+			setnMsg.Append(v)
+		}
+	}
+
+	var msgs []*osc.Message
+	for _, msg := range []*osc.Message{setMsg, setnMsg} {
+		if msg.CountArguments() > 1 {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
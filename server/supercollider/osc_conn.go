@@ -0,0 +1,147 @@
+package supercollider
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hypebeast/go-osc/osc"
+)
+
+// ErrOSCTimeout is returned when scsynth doesn't answer a request in time
+var ErrOSCTimeout = errors.New("timeout waiting for scsynth reply")
+
+// why we keep our own socket to scsynth:
+// - osc.Client dials a fresh socket per send, so replies have nowhere to go
+// - scsynth answers to the address a command came from
+// - one reader can hand each reply to whoever is waiting for it
+type oscConn struct {
+	conn    *net.UDPConn
+	mu      sync.Mutex
+	waiters map[string][]chan *osc.Message
+	done    chan struct{}
+	once    sync.Once
+}
+
+func dialOSC(port int) (*oscConn, error) {
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open OSC socket to port %d: %w", port, err)
+	}
+
+	c := &oscConn{
+		conn:    conn,
+		waiters: make(map[string][]chan *osc.Message),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+func (c *oscConn) readLoop() {
+	buf := make([]byte, 65536)
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			select {
+			case <-c.done:
+				return
+			default:
+			}
+			// connection refused until scsynth is listening; back off a little
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+
+		packet, err := osc.ParsePacket(string(buf[:n]))
+		if err != nil {
+			continue
+		}
+		c.dispatch(packet)
+	}
+}
+
+func (c *oscConn) dispatch(packet osc.Packet) {
+	switch p := packet.(type) {
+	case *osc.Message:
+		c.mu.Lock()
+		waiters := c.waiters[p.Address]
+		delete(c.waiters, p.Address)
+		c.mu.Unlock()
+
+		for _, ch := range waiters {
+			ch <- p
+		}
+	case *osc.Bundle:
+		for _, msg := range p.Messages {
+			c.dispatch(msg)
+		}
+		for _, bundle := range p.Bundles {
+			c.dispatch(bundle)
+		}
+	}
+}
+
+// Send writes a message without waiting for a reply
+func (c *oscConn) Send(msg *osc.Message) error {
+	data, err := msg.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write(data)
+	return err
+}
+
+// Request sends msg and waits for the next message at replyAddress
+func (c *oscConn) Request(msg *osc.Message, replyAddress string, timeout time.Duration) (*osc.Message, error) {
+	ch := make(chan *osc.Message, 1)
+
+	c.mu.Lock()
+	c.waiters[replyAddress] = append(c.waiters[replyAddress], ch)
+	c.mu.Unlock()
+
+	if err := c.Send(msg); err != nil {
+		c.removeWaiter(replyAddress, ch)
+		return nil, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case reply := <-ch:
+		return reply, nil
+	case <-timer.C:
+		c.removeWaiter(replyAddress, ch)
+		return nil, ErrOSCTimeout
+	case <-c.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (c *oscConn) removeWaiter(replyAddress string, ch chan *osc.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	waiters := c.waiters[replyAddress]
+	for i, w := range waiters {
+		if w == ch {
+			c.waiters[replyAddress] = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(c.waiters[replyAddress]) == 0 {
+		delete(c.waiters, replyAddress)
+	}
+}
+
+func (c *oscConn) Close() error {
+	var err error
+	c.once.Do(func() {
+		close(c.done)
+		err = c.conn.Close()
+	})
+	return err
+}
@@ -0,0 +1,79 @@
+package supercollider
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// a def's quality report sits beside it as <name>.quality.json
+const qualityReportSuffix = ".quality.json"
+
+// AudioAnalysis is what an offline render of a def measures as. Levels
+// are dBFS.
+type AudioAnalysis struct {
+	Duration float64 `json:"duration"`
+	PeakDb   float64 `json:"peak_db"`
+	RMSDb    float64 `json:"rms_db"`
+	// mean sample value of the worst channel, -1..1
+	DCOffset float64 `json:"dc_offset"`
+	// 0 for a pure tone up to 1 for white noise, averaged over non-silent frames
+	SpectralFlatness float64 `json:"spectral_flatness"`
+	// fraction of 100ms windows quieter than -60 dBFS
+	SilenceRatio float64 `json:"silence_ratio"`
+	// fraction of samples at or above -0.1 dBFS
+	ClippedRatio float64 `json:"clipped_ratio"`
+}
+
+// QualityReport is the outcome of checking a generated def before it's
+// served
+type QualityReport struct {
+	Analysis AudioAnalysis `json:"analysis"`
+	Passed   bool          `json:"passed"`
+	// the thresholds it missed, when it didn't pass
+	Failures  []string  `json:"failures,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// SaveQualityReport writes report beside the def name in dir
+func SaveQualityReport(dir, name string, report *QualityReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(qualityReportPath(dir, name), data, 0644)
+}
+
+// loadQualityReport reads the report beside a def, returning nil when the
+// def was never checked, as hand-written ones aren't
+func loadQualityReport(dir, name string) (*QualityReport, error) {
+	data, err := os.ReadFile(qualityReportPath(dir, name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var report QualityReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("invalid quality report: %w", err)
+	}
+	return &report, nil
+}
+
+func qualityReportPath(dir, name string) string {
+	return filepath.Join(dir, name+qualityReportSuffix)
+}
+
+// QuarantineDirectory is where generated defs that failed the quality
+// gate are moved, out of reach of renders and sessions but kept to look at
+func QuarantineDirectory() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get working directory: %v", err)
+	}
+	return filepath.Join(cwd, "supercollider", "quarantine"), nil
+}
@@ -0,0 +1,184 @@
+package supercollider
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hypebeast/go-osc/osc"
+)
+
+const (
+	statusPollInterval = 2 * time.Second
+	statusReplyTimeout = time.Second
+	// consecutive missed /status replies before scsynth counts as hung
+	unresponsiveAfter = 3
+	// peak dsp load, in percent, above which scsynth counts as overloaded
+	overloadedPeakCPU = 90
+)
+
+// engine health states
+const (
+	HealthStarting     = "starting"
+	HealthOK           = "ok"
+	HealthOverloaded   = "overloaded"
+	HealthUnresponsive = "unresponsive"
+	HealthStopped      = "stopped"
+)
+
+// EventEngineHealth is emitted through OnEvent when the health state changes
+const EventEngineHealth = "engine_health"
+
+// Status is scsynth's answer to /status
+type Status struct {
+	UGens             int32     `json:"ugens"`
+	Synths            int32     `json:"synths"`
+	Groups            int32     `json:"groups"`
+	SynthDefs         int32     `json:"synthdefs"`
+	AvgCPU            float32   `json:"avg_cpu"`
+	PeakCPU           float32   `json:"peak_cpu"`
+	NominalSampleRate float64   `json:"nominal_sample_rate"`
+	ActualSampleRate  float64   `json:"actual_sample_rate"`
+	ReceivedAt        time.Time `json:"received_at"`
+}
+
+// Health summarizes the engine for health checks and clients
+type Health struct {
+	State         string    `json:"state"`
+	Status        *Status   `json:"status,omitempty"`
+	LastReply     time.Time `json:"last_reply,omitempty"`
+	MissedReplies int       `json:"missed_replies"`
+}
+
+// parseStatusReply decodes
+// /status.reply 1 ugens synths groups defs avgCPU peakCPU nominalSR actualSR
+func parseStatusReply(msg *osc.Message) (Status, error) {
+	if len(msg.Arguments) < 9 {
+		return Status{}, fmt.Errorf("/status.reply has %d arguments, expected 9", len(msg.Arguments))
+	}
+
+	var status Status
+	ints := []*int32{&status.UGens, &status.Synths, &status.Groups, &status.SynthDefs}
+	for i, dst := range ints {
+		v, ok := msg.Arguments[i+1].(int32)
+		if !ok {
+			return Status{}, fmt.Errorf("/status.reply argument %d is %T, expected int32", i+1, msg.Arguments[i+1])
+		}
+		*dst = v
+	}
+
+	floats := []*float32{&status.AvgCPU, &status.PeakCPU}
+	for i, dst := range floats {
+		v, ok := msg.Arguments[i+5].(float32)
+		if !ok {
+			return Status{}, fmt.Errorf("/status.reply argument %d is %T, expected float32", i+5, msg.Arguments[i+5])
+		}
+		*dst = v
+	}
+
+	doubles := []*float64{&status.NominalSampleRate, &status.ActualSampleRate}
+	for i, dst := range doubles {
+		v, ok := msg.Arguments[i+7].(float64)
+		if !ok {
+			return Status{}, fmt.Errorf("/status.reply argument %d is %T, expected float64", i+7, msg.Arguments[i+7])
+		}
+		*dst = v
+	}
+
+	status.ReceivedAt = time.Now()
+	return status, nil
+}
+
+// QueryStatus asks scsynth for its status and waits for the reply
+func (s *SuperColliderSynth) QueryStatus() (Status, error) {
+	s.healthMu.Lock()
+	conn := s.oscConn
+	s.healthMu.Unlock()
+	if conn == nil {
+		return Status{}, fmt.Errorf("scsynth is not running")
+	}
+
+	reply, err := conn.Request(osc.NewMessage("/status"), "/status.reply", statusReplyTimeout)
+	if err != nil {
+		return Status{}, err
+	}
+	return parseStatusReply(reply)
+}
+
+// Health returns the latest health reading from the status monitor
+func (s *SuperColliderSynth) Health() Health {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+
+	health := s.health
+	if health.State == "" {
+		health.State = HealthStopped
+	}
+	return health
+}
+
+// SetOnEvent registers a callback for engine events such as health changes
+func (s *SuperColliderSynth) SetOnEvent(callback func(eventType string, data interface{})) {
+	s.OnEvent = callback
+}
+
+func (s *SuperColliderSynth) emit(eventType string, data interface{}) {
+	if s.OnEvent != nil {
+		s.OnEvent(eventType, data)
+	}
+}
+
+// why we poll /status:
+// - a hung scsynth keeps its process and its JACK ports but goes silent
+// - dsp load creeping toward 100% predicts dropouts before listeners hear them
+// - the reply is cheap, so every session can afford it
+func (s *SuperColliderSynth) monitorStatus(stop <-chan struct{}) {
+	ticker := time.NewTicker(statusPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			status, err := s.QueryStatus()
+			s.recordStatus(status, err)
+		}
+	}
+}
+
+func (s *SuperColliderSynth) recordStatus(status Status, err error) {
+	s.healthMu.Lock()
+
+	previous := s.health.State
+	if err != nil {
+		s.health.MissedReplies++
+		if s.health.MissedReplies >= unresponsiveAfter {
+			s.health.State = HealthUnresponsive
+		}
+	} else {
+		s.health.Status = &status
+		s.health.LastReply = status.ReceivedAt
+		s.health.MissedReplies = 0
+		s.health.State = HealthOK
+		if status.PeakCPU >= overloadedPeakCPU {
+			s.health.State = HealthOverloaded
+		}
+	}
+	health := s.health
+	s.healthMu.Unlock()
+
+	if health.State != previous {
+		log.Printf("[SCSYNTH][%s] Health changed: %s -> %s", s.Id, previous, health.State)
+		s.emit(EventEngineHealth, health)
+		if health.State == HealthUnresponsive {
+			go s.killHung()
+		}
+	}
+}
+
+func (s *SuperColliderSynth) setHealthState(state string) {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	s.health = Health{State: state}
+}
@@ -2,19 +2,21 @@ package supercollider
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hypebeast/go-osc/osc"
 	"github.com/po-studio/server/jack"
+	"github.com/po-studio/server/scsyndef"
 	"github.com/po-studio/server/utils"
 )
 
@@ -28,6 +30,28 @@ type SuperColliderSynth struct {
 	outputReader   *io.PipeReader
 	OnClientName   func(string)
 	ActiveSynthId  string
+	ActiveNodeId   int32
+
+	// guards the active node's controls and current values
+	mu           sync.Mutex
+	controls     []scsyndef.Control
+	params       ControlValues
+	nextNodeId   int32
+	fadeDone     chan struct{}
+	fadeFinished chan struct{}
+
+	OnEvent func(eventType string, data interface{})
+
+	// serializes Stop against supervisor restarts
+	lifecycleMu sync.Mutex
+	stopped     bool
+	restarts    []time.Time
+
+	// guards the status socket and the latest health reading
+	healthMu    sync.Mutex
+	oscConn     *oscConn
+	health      Health
+	stopMonitor chan struct{}
 }
 
 const (
@@ -53,43 +77,36 @@ func (s *SuperColliderSynth) Start() error {
 	s.Port = port
 
 	// First ensure GStreamer pipeline is ready
-	gstPortsChan := make(chan []string)
-	gstErrChan := make(chan error)
-	timeout := time.After(10 * time.Second)
-
-	go func() {
-		for {
-			ports, err := jack.GetGStreamerJackPorts(s.Id)
-			if err != nil {
-				gstErrChan <- err
-				return
-			}
-			if len(ports) > 0 {
-				gstPortsChan <- ports
-				return
-			}
-			time.Sleep(100 * time.Millisecond)
-		}
-	}()
-
-	// Wait for GStreamer ports
-	var gstJackPorts []string
-	select {
-	case ports := <-gstPortsChan:
-		gstJackPorts = ports
-	case err := <-gstErrChan:
+	gstJackPorts, err := jack.WaitForGStreamerJackPorts(s.Id, 10*time.Second)
+	if err != nil {
 		return fmt.Errorf("error finding GStreamer-JACK ports: %v", err)
-	case <-timeout:
-		return fmt.Errorf("timeout waiting for GStreamer-JACK ports")
 	}
 
 	s.GStreamerPorts = strings.Join(gstJackPorts, ",")
 
-	// Now start SuperCollider
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+	s.stopped = false
+	return s.launch()
+}
+
+// launch starts scsynth on s.Port, waits for it to answer and wires its
+// outputs into the session's pipeline. Used by Start and by the supervisor.
+// Callers must hold s.lifecycleMu.
+func (s *SuperColliderSynth) launch() error {
 	if err := s.setupCmd(); err != nil {
 		return err
 	}
 
+	conn, err := dialOSC(s.Port)
+	if err != nil {
+		return err
+	}
+	s.healthMu.Lock()
+	s.oscConn = conn
+	s.health = Health{State: HealthStarting}
+	s.healthMu.Unlock()
+
 	if err := s.Cmd.Start(); err != nil {
 		return fmt.Errorf("failed to start scsynth: %v", err)
 	}
@@ -97,17 +114,44 @@ func (s *SuperColliderSynth) Start() error {
 
 	// Wait for SuperCollider to be ready
 	if err := s.waitForSuperColliderReady(); err != nil {
+		s.abandonProcess()
 		return fmt.Errorf("SuperCollider failed to initialize: %v", err)
 	}
 
 	// Finally connect the ports
 	if err := s.waitForJackPorts(); err != nil {
+		s.abandonProcess()
 		return fmt.Errorf("failed to setup JACK connections: %v", err)
 	}
 
+	s.startStatusMonitor()
+	go s.watchProcess(s.Cmd)
 	return nil
 }
 
+func (s *SuperColliderSynth) startStatusMonitor() {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	s.stopMonitor = make(chan struct{})
+	go s.monitorStatus(s.stopMonitor)
+}
+
+// stops polling and closes the status socket
+func (s *SuperColliderSynth) stopStatusMonitor() {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+
+	if s.stopMonitor != nil {
+		close(s.stopMonitor)
+		s.stopMonitor = nil
+	}
+	if s.oscConn != nil {
+		s.oscConn.Close()
+		s.oscConn = nil
+	}
+	s.health = Health{State: HealthStopped}
+}
+
 // setupCmd prepares the scsynth command with the appropriate arguments and environment variables
 func (s *SuperColliderSynth) setupCmd() error {
 	logFilePath := fmt.Sprintf("%s/scsynth_%s.log", DefaultSuperColliderLogDir, s.Id)
@@ -175,8 +219,20 @@ func (s *SuperColliderSynth) setupCmd() error {
 func (s *SuperColliderSynth) Stop() error {
 	log.Printf("[SCSYNTH][%s] Starting cleanup sequence", s.Id)
 
+	// waits out a restart attempt in progress, then keeps the supervisor away
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+	s.stopped = true
+
+	// settle any crossfade so its goroutine isn't left talking to a dead port
+	s.mu.Lock()
+	s.finishFade()
+	s.mu.Unlock()
+
+	s.stopStatusMonitor()
+
 	// First disconnect JACK ports
-	if err := jack.DisconnectJackPorts(s.Id, s.JackClientName); err != nil {
+	if err := jack.DisconnectSession(s.Id); err != nil {
 		log.Printf("[SCSYNTH][%s] Warning: error disconnecting JACK ports: %v", s.Id, err)
 	} else {
 		log.Printf("[SCSYNTH][%s] Successfully disconnected JACK ports", s.Id)
@@ -210,7 +266,7 @@ func (s *SuperColliderSynth) Stop() error {
 
 	// Kill the scsynth process if it's still running
 	if s.Cmd != nil && s.Cmd.Process != nil {
-		if err := s.Cmd.Process.Kill(); err != nil {
+		if err := s.Cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
 			log.Printf("[SCSYNTH][%s] Failed to kill process: %v", s.Id, err)
 			return fmt.Errorf("failed to kill scsynth process: %w", err)
 		}
@@ -221,72 +277,203 @@ func (s *SuperColliderSynth) Stop() error {
 	return nil
 }
 
-// SendPlayMessage sends an OSC message to the SuperCollider server to play a random synth
-func (s *SuperColliderSynth) SendPlayMessage() {
+// SendPlayMessage starts a synth node on the SuperCollider server. An empty
+// synthDefName picks a random def; params override the def's defaults.
+func (s *SuperColliderSynth) SendPlayMessage(synthDefName string, params ControlValues) error {
 	client := osc.NewClient("127.0.0.1", s.Port)
-	msg := osc.NewMessage("/s_new")
 
-	synthDefName, err := utils.GetRandomSynthDefName()
+	if synthDefName == "" {
+		randomName, err := utils.GetRandomSynthDefName()
+		if err != nil {
+			return fmt.Errorf("could not find synthdef name: %w", err)
+		}
+		synthDefName = randomName
+	}
+
+	entry, err := DefaultCatalog().Lookup(synthDefName)
 	if err != nil {
-		log.Printf("Could not find synthdef name: %v", err)
-		return
+		return err
+	}
+	if err := ValidateParams(synthDefName, entry.Controls, params); err != nil {
+		return err
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.ActiveSynthId = synthDefName
+	s.ActiveNodeId = s.allocNodeId()
+	s.controls = entry.Controls
+	s.params = make(ControlValues, len(entry.Controls))
+	for _, c := range entry.Controls {
+		s.params[c.Name] = append(ControlValue(nil), c.Defaults...)
+	}
+	s.applyParams(params)
 
+	return s.sendNewNode(client, synthDefName, s.ActiveNodeId, params)
+}
+
+// sendNewNode sends /s_new for a node, followed by /n_setn for any
+// multi-value params
+func (s *SuperColliderSynth) sendNewNode(client *osc.Client, synthDefName string, nodeId int32, params ControlValues) error {
+	messages := NewNodeMessages(synthDefName, nodeId, params)
+
+	log.Printf("Sending OSC message: %v", messages[0])
+	if err := client.Send(messages[0]); err != nil {
+		return fmt.Errorf("error sending OSC message: %w", err)
+	}
+	log.Println("OSC message sent successfully.")
+
+	for _, setMsg := range messages[1:] {
+		if err := client.Send(setMsg); err != nil {
+			return fmt.Errorf("failed to send %s: %w", setMsg.Address, err)
+		}
+	}
+
+	return nil
+}
+
+// NewNodeMessages builds /s_new for a node at the head of the default
+// group, followed by /n_setn for any multi-value params
+func NewNodeMessages(synthDefName string, nodeId int32, params ControlValues) []*osc.Message {
+	msg := osc.NewMessage("/s_new")
 	msg.Append(synthDefName)
-	msg.Append(int32(1)) // node ID
+	msg.Append(nodeId)   // node ID
 	msg.Append(int32(0)) // action: 0 for add to head
 	msg.Append(int32(0)) // target group ID
 
-	log.Printf("Sending OSC message: %v", msg)
-	if err := client.Send(msg); err != nil {
-		log.Printf("Error sending OSC message: %v\n", err)
-	} else {
-		log.Println("OSC message sent successfully.")
+	// scalar initial values ride along on /s_new, array controls
+	// follow straight after as /n_setn
+	arrays := make(ControlValues)
+	for _, name := range params.sortedNames() {
+		if len(params[name]) == 1 {
+			msg.Append(name, params[name][0])
+		} else {
+			arrays[name] = params[name]
+		}
 	}
+
+	return append([]*osc.Message{msg}, controlMessages(nodeId, arrays)...)
 }
 
-func (s *SuperColliderSynth) waitForSuperColliderReady() error {
+// SetParams changes named controls on the running node. Scalar values are
+// batched into a single /n_set, multi-value controls go through /n_setn.
+// Returns the full set of current control values.
+func (s *SuperColliderSynth) SetParams(params ControlValues) (ControlValues, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ActiveNodeId == 0 || s.ActiveSynthId == "" {
+		return nil, ErrNoActiveSynth
+	}
+
+	// validate everything before sending anything so a bad name
+	// doesn't leave the node half-updated
+	if err := ValidateParams(s.ActiveSynthId, s.controls, params); err != nil {
+		return nil, err
+	}
+
 	client := osc.NewClient("127.0.0.1", s.Port)
+	for _, msg := range controlMessages(s.ActiveNodeId, params) {
+		log.Printf("[SCSYNTH][%s] Sending OSC message: %v", s.Id, msg)
+		if err := client.Send(msg); err != nil {
+			return nil, fmt.Errorf("failed to send %s: %w", msg.Address, err)
+		}
+	}
+
+	s.applyParams(params)
+	return s.paramsSnapshot(), nil
+}
+
+// callers must hold s.mu and have validated params
+func (s *SuperColliderSynth) applyParams(params ControlValues) {
+	for name, value := range params {
+		copy(s.params[name], value)
+	}
+}
+
+// GetParams returns the current values of every control on the active node
+func (s *SuperColliderSynth) GetParams() (ControlValues, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ActiveNodeId == 0 || s.ActiveSynthId == "" {
+		return nil, ErrNoActiveSynth
+	}
+	return s.paramsSnapshot(), nil
+}
+
+// ActiveSynthDef returns the name of the synthdef on the active node
+func (s *SuperColliderSynth) ActiveSynthDef() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ActiveSynthId
+}
+
+// callers must hold s.mu
+func (s *SuperColliderSynth) paramsSnapshot() ControlValues {
+	snapshot := make(ControlValues, len(s.params))
+	for name, value := range s.params {
+		snapshot[name] = append(ControlValue(nil), value...)
+	}
+	return snapshot
+}
+
+// scsynth is ready once it answers /status and has logged the JACK client
+// name we need to wire its outputs
+func (s *SuperColliderSynth) waitForSuperColliderReady() error {
 	timeout := time.After(10 * time.Second)
 	ticker := time.NewTicker(100 * time.Millisecond)
 	defer ticker.Stop()
 
 	// Read scsynth output to find JACK client name
-	scanner := bufio.NewScanner(s.outputReader)
+	reader := s.outputReader
+	scanner := bufio.NewScanner(reader)
 	clientNameChan := make(chan string, 1)
 
 	go func() {
+		found := false
 		for scanner.Scan() {
 			line := scanner.Text()
 			// HACK: This is a hack to get the client name from the scsynth output
 			// TODO: Find a better way to do this, but scsynth doesn't offer a clean
 			// way to get this with JACK
-			if strings.Contains(line, "JackDriver: client name is") {
+			if !found && strings.Contains(line, "JackDriver: client name is") {
 				parts := strings.Split(line, "'")
 				if len(parts) >= 2 {
-					clientName := parts[1]
-					clientNameChan <- clientName
-					return
+					found = true
+					clientNameChan <- parts[1]
 				}
 			}
 		}
+		// keep draining, otherwise scsynth blocks on a full pipe and
+		// Cmd.Wait never returns
+		io.Copy(io.Discard, reader)
 	}()
 
+	var statusReady bool
+
 	// Wait for both client name and server readiness
 	for {
 		select {
 		case <-timeout:
-			return fmt.Errorf("timeout waiting for SuperCollider to initialize")
+			return fmt.Errorf("timeout waiting for SuperCollider to initialize (status reply: %v, JACK client: %q)", statusReady, s.JackClientName)
 		case clientName := <-clientNameChan:
 			s.JackClientName = clientName
+			jack.ClaimClient(s.Id, clientName)
 			if s.OnClientName != nil {
 				s.OnClientName(clientName)
 			}
 		case <-ticker.C:
-			msg := osc.NewMessage("/status")
-			if err := client.Send(msg); err == nil && s.JackClientName != "" {
+			if !statusReady {
+				status, err := s.QueryStatus()
+				if err != nil {
+					continue
+				}
+				statusReady = true
+				s.recordStatus(status, nil)
+			}
+			if s.JackClientName != "" {
 				return nil
 			}
 		}
@@ -294,62 +481,43 @@ func (s *SuperColliderSynth) waitForSuperColliderReady() error {
 }
 
 func (s *SuperColliderSynth) waitForJackPorts() error {
-	portsChan := make(chan []string)
-	errChan := make(chan error)
-	timeout := time.After(10 * time.Second)
+	client, err := jack.Default()
+	if err != nil {
+		return fmt.Errorf("error checking JACK ports: %v", err)
+	}
 
 	expectedPort1 := fmt.Sprintf("%s:out_1", s.JackClientName)
 	expectedPort2 := fmt.Sprintf("%s:out_2", s.JackClientName)
 
-	go func() {
-		for {
-			cmd := exec.Command("jack_lsp")
-			output, err := cmd.CombinedOutput()
-			if err != nil {
-				errChan <- fmt.Errorf("error checking JACK ports: %v", err)
-				return
-			}
-
-			if strings.Contains(string(output), expectedPort1) {
-				portsChan <- []string{expectedPort1, expectedPort2}
-				return
-			}
-			time.Sleep(100 * time.Millisecond)
-		}
-	}()
-
-	select {
-	case ports := <-portsChan:
-		return s.connectJackPorts(ports)
-	case err := <-errChan:
+	if _, err := client.WaitForPorts(10*time.Second, func(port string) bool {
+		return port == expectedPort1
+	}); err != nil {
 		return err
-	case <-timeout:
-		return fmt.Errorf("timeout waiting for JACK ports")
 	}
+
+	return s.connectJackPorts(client, []string{expectedPort1, expectedPort2})
 }
 
-func (s *SuperColliderSynth) connectJackPorts(scPorts []string) error {
-	cmd := exec.Command("jack_lsp", "-c")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to list JACK connections: %v", err)
+func (s *SuperColliderSynth) connectJackPorts(client *jack.Client, scPorts []string) error {
+	// the session's jackaudiosrc inputs, keyed by channel
+	gstPorts := make(map[int]string)
+	for _, port := range client.SessionPorts(s.Id) {
+		if _, channel, ok := jack.ParseSourcePort(port.Short); ok {
+			gstPorts[channel] = port.Name
+		}
 	}
-
-	// Match either "webrtc-server" or "webrtc-server-<number>"
-	re := regexp.MustCompile(`(webrtc-server(?:-\d+)?):in_` + regexp.QuoteMeta(s.Id))
-	matches := re.FindStringSubmatch(string(output))
-	if len(matches) < 2 {
-		log.Printf("Available JACK ports:\n%s", string(output))
+	if len(gstPorts) == 0 {
+		log.Printf("Available JACK ports:\n%s", client.Describe())
 		return fmt.Errorf("could not find webrtc-server ports for session %s", s.Id)
 	}
-	webrtcClientName := matches[1]
-	log.Printf("Found WebRTC client name: %s", webrtcClientName)
 
 	for i, scPort := range scPorts {
-		gstPort := fmt.Sprintf("%s:in_%s_%d", webrtcClientName, s.Id, i+1)
-		cmd = exec.Command("jack_connect", scPort, gstPort)
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to connect %s to %s: %v", scPort, gstPort, err)
+		gstPort, ok := gstPorts[i+1]
+		if !ok {
+			return fmt.Errorf("session %s has no GStreamer input for channel %d", s.Id, i+1)
+		}
+		if err := client.Connect(scPort, gstPort); err != nil {
+			return err
 		}
 		log.Printf("Successfully connected %s to %s", scPort, gstPort)
 	}
@@ -377,9 +545,9 @@ func (s *SuperColliderSynth) GetSynthCode() (string, error) {
 	parts := strings.Split(s.ActiveSynthId, "-")
 	var searchPattern string
 	if len(parts) >= 4 {
-		// OpenAI format with timestamp
-		timestamp := parts[len(parts)-1]
-		searchPattern = timestamp
+		// Generated format; sources are named by the timestamp in older
+		// ids and by the whole id, ending in a random suffix, in newer ones
+		searchPattern = parts[len(parts)-1]
 	} else {
 		// Human format (e.g., romero_1)
 		searchPattern = s.ActiveSynthId
@@ -0,0 +1,210 @@
+package supercollider
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/hypebeast/go-osc/osc"
+	"github.com/po-studio/server/jack"
+)
+
+const (
+	// pause before relaunching, so a crash loop can't spin a core
+	restartDelay = 500 * time.Millisecond
+	// at most maxRestarts within restartWindow before we give up
+	maxRestarts   = 5
+	restartWindow = 5 * time.Minute
+)
+
+// engine lifecycle events emitted through OnEvent
+const (
+	EventEngineRestarted = "engine_restarted"
+	EventEngineFailed    = "engine_failed"
+)
+
+// EngineRestart is the payload of engine_restarted and engine_failed events
+type EngineRestart struct {
+	Reason  string `json:"reason"`
+	Attempt int    `json:"attempt"`
+	Synth   string `json:"synth,omitempty"`
+	// seconds between noticing the failure and the synth playing again
+	Downtime float64 `json:"downtime,omitempty"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// why we supervise scsynth:
+// - a crashed scsynth leaves the stream up but silent, and nobody notices
+// - the session, port and pipeline are all still good, only the process is gone
+// - replaying the last node means listeners hear a short gap, not the end
+func (s *SuperColliderSynth) watchProcess(cmd *exec.Cmd) {
+	err := cmd.Wait()
+
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+
+	// a deliberate Stop, or a process we already replaced
+	if s.stopped || s.Cmd != cmd {
+		return
+	}
+
+	reason := "scsynth exited"
+	if err != nil {
+		reason = fmt.Sprintf("scsynth exited: %v", err)
+	}
+	log.Printf("[SCSYNTH][%s][SUPERVISOR] %s", s.Id, reason)
+	s.restart(reason)
+}
+
+// callers must hold s.lifecycleMu. It's released while waiting between
+// attempts, so Stop only ever waits out the launch in progress.
+func (s *SuperColliderSynth) restart(reason string) {
+	began := time.Now()
+
+	s.stopStatusMonitor()
+	s.closeOutput()
+	if s.JackClientName != "" {
+		jack.ReleaseClient(s.JackClientName)
+		s.JackClientName = ""
+	}
+
+	var lastErr error
+	for {
+		attempt, ok := s.allowRestart(began)
+		if !ok {
+			log.Printf("[SCSYNTH][%s][SUPERVISOR] Giving up after %d restarts in %v", s.Id, maxRestarts, restartWindow)
+			failure := EngineRestart{Reason: reason, Attempt: attempt, Synth: s.ActiveSynthDef()}
+			if lastErr != nil {
+				failure.Error = lastErr.Error()
+			}
+			s.setHealthState(HealthStopped)
+			s.emit(EventEngineFailed, failure)
+			return
+		}
+
+		s.lifecycleMu.Unlock()
+		time.Sleep(restartDelay)
+		s.lifecycleMu.Lock()
+		if s.stopped {
+			log.Printf("[SCSYNTH][%s][SUPERVISOR] Stopped while restarting, giving up", s.Id)
+			return
+		}
+
+		log.Printf("[SCSYNTH][%s][SUPERVISOR] Restarting scsynth on port %d (attempt %d)", s.Id, s.Port, attempt)
+
+		lastErr = s.launch()
+		if lastErr == nil {
+			break
+		}
+		log.Printf("[SCSYNTH][%s][SUPERVISOR] Restart failed: %v", s.Id, lastErr)
+		s.stopStatusMonitor()
+		s.closeOutput()
+	}
+
+	synthDef, err := s.replayActiveNode()
+	if err != nil {
+		log.Printf("[SCSYNTH][%s][SUPERVISOR] Failed to restore %s: %v", s.Id, synthDef, err)
+	}
+
+	downtime := time.Since(began)
+	log.Printf("[SCSYNTH][%s][SUPERVISOR] scsynth restarted, audio back after %v", s.Id, downtime)
+	s.emit(EventEngineRestarted, EngineRestart{
+		Reason:   reason,
+		Attempt:  len(s.restarts),
+		Synth:    synthDef,
+		Downtime: downtime.Seconds(),
+	})
+}
+
+// allowRestart records a restart attempt unless the budget for the window
+// is spent. Callers must hold s.lifecycleMu.
+func (s *SuperColliderSynth) allowRestart(now time.Time) (int, bool) {
+	recent := s.restarts[:0]
+	for _, t := range s.restarts {
+		if now.Sub(t) < restartWindow {
+			recent = append(recent, t)
+		}
+	}
+	s.restarts = recent
+
+	if len(s.restarts) >= maxRestarts {
+		return len(s.restarts), false
+	}
+	s.restarts = append(s.restarts, now)
+	return len(s.restarts), true
+}
+
+// replayActiveNode recreates the node that was playing, with its last known
+// params, on a freshly started scsynth
+func (s *SuperColliderSynth) replayActiveNode() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// a half-finished crossfade died with the old process
+	s.finishFade()
+
+	if s.ActiveNodeId == 0 || s.ActiveSynthId == "" {
+		return "", nil
+	}
+	client := osc.NewClient("127.0.0.1", s.Port)
+	return s.ActiveSynthId, s.sendNewNode(client, s.ActiveSynthId, s.ActiveNodeId, s.paramsSnapshot())
+}
+
+// ConnectOutputs rewires scsynth's outputs into the session's pipeline,
+// e.g. after the pipeline was rebuilt and registered fresh ports
+func (s *SuperColliderSynth) ConnectOutputs() error {
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+
+	if s.stopped || s.JackClientName == "" {
+		return fmt.Errorf("scsynth is not running")
+	}
+	if _, err := jack.WaitForGStreamerJackPorts(s.Id, 10*time.Second); err != nil {
+		return fmt.Errorf("error finding GStreamer-JACK ports: %v", err)
+	}
+	return s.waitForJackPorts()
+}
+
+// killHung kills a process that stopped answering /status; watchProcess
+// takes it from there
+func (s *SuperColliderSynth) killHung() {
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+
+	if s.stopped || s.Cmd == nil || s.Cmd.Process == nil {
+		return
+	}
+	log.Printf("[SCSYNTH][%s][SUPERVISOR] scsynth is unresponsive, killing it", s.Id)
+	s.killProcess()
+}
+
+func (s *SuperColliderSynth) killProcess() {
+	if s.Cmd == nil || s.Cmd.Process == nil {
+		return
+	}
+	if err := s.Cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		log.Printf("[SCSYNTH][%s] Failed to kill process: %v", s.Id, err)
+	}
+}
+
+// abandonProcess kills a process that never finished launching and reaps
+// it, since no watcher was started for it
+func (s *SuperColliderSynth) abandonProcess() {
+	s.killProcess()
+	go s.Cmd.Wait()
+}
+
+// closeOutput releases the previous run's log file and output pipe
+func (s *SuperColliderSynth) closeOutput() {
+	if s.outputReader != nil {
+		s.outputReader.Close()
+		s.outputReader = nil
+	}
+	if s.LogFile != nil {
+		s.LogFile.Close()
+		s.LogFile = nil
+	}
+}
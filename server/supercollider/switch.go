@@ -0,0 +1,228 @@
+package supercollider
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/hypebeast/go-osc/osc"
+	"github.com/po-studio/server/scsyndef"
+)
+
+const (
+	// DefaultCrossfade is used when a switch request doesn't specify one
+	DefaultCrossfade = 2 * time.Second
+	// MaxCrossfade keeps a typo from leaving two nodes running for hours
+	MaxCrossfade = 60 * time.Second
+
+	crossfadeStep = 50 * time.Millisecond
+	firstNodeId   = 1000
+)
+
+// ErrInvalidCrossfade is returned for crossfades outside [0, MaxCrossfade]
+var ErrInvalidCrossfade = errors.New("invalid crossfade")
+
+// fadeControls are tried in order to find a gain control to crossfade.
+// amp is the template convention, but most hand-written defs use masterGain.
+var fadeControls = []string{"amp", "masterGain"}
+
+// a node taking part in a crossfade
+type fadeNode struct {
+	id      int32
+	control string  // empty if the def has no gain control
+	level   float32 // the level the node plays at when fully faded in
+}
+
+func newFadeNode(id int32, controls []scsyndef.Control, params ControlValues) fadeNode {
+	node := fadeNode{id: id}
+	for _, name := range fadeControls {
+		for _, c := range controls {
+			if c.Name != name || len(c.Defaults) != 1 {
+				continue
+			}
+			node.control = name
+			node.level = c.Defaults[0]
+			if v, ok := params[name]; ok && len(v) == 1 {
+				node.level = v[0]
+			}
+			return node
+		}
+	}
+	return node
+}
+
+// callers must hold s.mu
+func (s *SuperColliderSynth) allocNodeId() int32 {
+	if s.nextNodeId < firstNodeId {
+		s.nextNodeId = firstNodeId
+	}
+	id := s.nextNodeId
+	s.nextNodeId++
+	return id
+}
+
+// SwitchSynth starts synthDefName on a fresh node and crossfades to it from
+// the currently playing node, which is freed once the fade completes. The
+// call returns as soon as the new node is running; the fade itself happens
+// in the background. Defs without a gain control switch hard at the midpoint.
+func (s *SuperColliderSynth) SwitchSynth(synthDefName string, params ControlValues, crossfade time.Duration) error {
+	if crossfade < 0 || crossfade > MaxCrossfade {
+		return fmt.Errorf("%w: must be between 0 and %v", ErrInvalidCrossfade, MaxCrossfade)
+	}
+
+	entry, err := DefaultCatalog().Lookup(synthDefName)
+	if err != nil {
+		return err
+	}
+	if err := ValidateParams(synthDefName, entry.Controls, params); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ActiveNodeId == 0 || s.ActiveSynthId == "" {
+		return ErrNoActiveSynth
+	}
+
+	// a switch during a fade finishes the previous fade immediately,
+	// so at most two nodes are ever sounding
+	s.finishFade()
+
+	client := osc.NewClient("127.0.0.1", s.Port)
+	oldNode := newFadeNode(s.ActiveNodeId, s.controls, s.params)
+	newNode := newFadeNode(s.allocNodeId(), entry.Controls, params)
+	if crossfade == 0 {
+		oldNode.control, newNode.control = "", ""
+	}
+
+	msg := osc.NewMessage("/s_new", synthDefName, newNode.id, int32(0), int32(0))
+	arrays := make(ControlValues)
+	for _, name := range params.sortedNames() {
+		if name == newNode.control {
+			continue
+		}
+		if len(params[name]) == 1 {
+			msg.Append(name, params[name][0])
+		} else {
+			arrays[name] = params[name]
+		}
+	}
+	if newNode.control != "" {
+		// start silent and let the fade bring it up
+		msg.Append(newNode.control, float32(0))
+	}
+
+	log.Printf("[SCSYNTH][%s] Switching %s (node %d) -> %s (node %d) over %v",
+		s.Id, s.ActiveSynthId, oldNode.id, synthDefName, newNode.id, crossfade)
+
+	if err := client.Send(msg); err != nil {
+		return fmt.Errorf("failed to start %s: %w", synthDefName, err)
+	}
+	for _, setMsg := range controlMessages(newNode.id, arrays) {
+		if err := client.Send(setMsg); err != nil {
+			return fmt.Errorf("failed to send %s: %w", setMsg.Address, err)
+		}
+	}
+	if newNode.control == "" && crossfade > 0 {
+		// hold it paused until the midpoint
+		client.Send(osc.NewMessage("/n_run", newNode.id, int32(0)))
+	}
+
+	s.ActiveSynthId = synthDefName
+	s.ActiveNodeId = newNode.id
+	s.controls = entry.Controls
+	s.params = make(ControlValues, len(entry.Controls))
+	for _, c := range entry.Controls {
+		s.params[c.Name] = append(ControlValue(nil), c.Defaults...)
+	}
+	s.applyParams(params)
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	s.fadeDone = done
+	s.fadeFinished = finished
+	go s.runCrossfade(client, oldNode, newNode, crossfade, done, finished)
+
+	return nil
+}
+
+// finishFade cuts any in-progress crossfade short, leaving the newest node
+// at full level and the old one freed. Callers must hold s.mu.
+func (s *SuperColliderSynth) finishFade() {
+	if s.fadeDone == nil {
+		return
+	}
+	close(s.fadeDone)
+	<-s.fadeFinished
+	s.fadeDone = nil
+	s.fadeFinished = nil
+}
+
+// why we fade from go rather than inside scsynth:
+// - works with any def that exposes a gain control, no wrapper synth needed
+// - 50ms steps are inaudible on the lagged gain most defs apply
+// - an equal-power curve avoids the dip of a linear crossfade
+func (s *SuperColliderSynth) runCrossfade(client *osc.Client, oldNode, newNode fadeNode, crossfade time.Duration, done <-chan struct{}, finished chan<- struct{}) {
+	defer close(finished)
+
+	setLevels := func(t float64) {
+		if oldNode.control != "" {
+			level := oldNode.level * float32(math.Cos(t*math.Pi/2))
+			client.Send(osc.NewMessage("/n_set", oldNode.id, oldNode.control, level))
+		}
+		if newNode.control != "" {
+			level := newNode.level * float32(math.Sin(t*math.Pi/2))
+			client.Send(osc.NewMessage("/n_set", newNode.id, newNode.control, level))
+		}
+	}
+
+	midpointPassed := false
+	complete := func() {
+		setLevels(1)
+		if newNode.control == "" && !midpointPassed {
+			client.Send(osc.NewMessage("/n_run", newNode.id, int32(1)))
+		}
+		if err := client.Send(osc.NewMessage("/n_free", oldNode.id)); err != nil {
+			log.Printf("[SCSYNTH][%s] Failed to free node %d: %v", s.Id, oldNode.id, err)
+		}
+		log.Printf("[SCSYNTH][%s] Crossfade complete, freed node %d", s.Id, oldNode.id)
+	}
+
+	if crossfade == 0 {
+		complete()
+		return
+	}
+
+	ticker := time.NewTicker(crossfadeStep)
+	defer ticker.Stop()
+	start := time.Now()
+
+	for {
+		select {
+		case <-done:
+			complete()
+			return
+		case <-ticker.C:
+			t := float64(time.Since(start)) / float64(crossfade)
+			if t >= 1 {
+				complete()
+				return
+			}
+
+			// sides without a gain control switch hard at the midpoint
+			if t >= 0.5 && !midpointPassed {
+				midpointPassed = true
+				if newNode.control == "" {
+					client.Send(osc.NewMessage("/n_run", newNode.id, int32(1)))
+				}
+				if oldNode.control == "" {
+					client.Send(osc.NewMessage("/n_run", oldNode.id, int32(0)))
+				}
+			}
+			setLevels(t)
+		}
+	}
+}
@@ -1,22 +1,76 @@
 package supercollider
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"time"
+	"strings"
 )
 
+// the compile script rewrites .add into a writeDefFile to the directory it
+// is given, so generated defs land beside their sources until checked
+// rather than straight in the directory sessions play from
 const SuperColliderSynthTemplate = `
 SynthDef.new("%s", { |out=0, amp=0.5|
     var sound;
     %s
     Out.ar(out, sound * amp);
-}).writeDefFile("/app/sc/synthdefs");
+}).add;
 `
 
+// the most compiler output a CompileError keeps; runtime errors come with
+// long backtraces and only the top matters
+const maxCompileErrorOutput = 4000
+
+// CompileError is returned by SaveSynthDef when sclang rejects the code,
+// as opposed to the filesystem failing around it
+type CompileError struct {
+	// sclang's diagnostics, without the compile script's own chatter
+	Output string
+	Err    error
+}
+
+func (e *CompileError) Error() string {
+	return fmt.Sprintf("failed to compile synthdef: %v", e.Err)
+}
+
+func (e *CompileError) Unwrap() error {
+	return e.Err
+}
+
+// why we trim the compile output:
+// - the script echoes paths and lists the output directory around sclang
+// - sclang's own errors start at the first ERROR line
+func newCompileError(err error, output []byte) *CompileError {
+	lines := strings.Split(string(output), "\n")
+	start := 0
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "ERROR") {
+			start = i
+			break
+		}
+	}
+
+	var kept []string
+	for _, line := range lines[start:] {
+		// the compile script's own trailer
+		if strings.HasPrefix(line, "SynthDef compilation completed") ||
+			strings.HasPrefix(line, "SuperCollider compiler exit code:") {
+			break
+		}
+		kept = append(kept, line)
+	}
+
+	diagnostics := strings.TrimSpace(strings.Join(kept, "\n"))
+	if len(diagnostics) > maxCompileErrorOutput {
+		diagnostics = diagnostics[:maxCompileErrorOutput] + "\n..."
+	}
+	return &CompileError{Output: diagnostics, Err: err}
+}
+
 func SaveSynthDef(id, provider, model, coreLogic string) error {
 	log.Printf("[SYNTHDEF] Starting to save synthdef for id=%s", id)
 
@@ -28,7 +82,7 @@ func SaveSynthDef(id, provider, model, coreLogic string) error {
 
 	// Create all necessary directories
 	dirs := []string{
-		filepath.Join(cwd, "supercollider", "synthdefs"),
+		generatedSynthDefDir(cwd),
 		filepath.Join(cwd, "supercollider", "src", provider, model),
 	}
 
@@ -44,8 +98,8 @@ func SaveSynthDef(id, provider, model, coreLogic string) error {
 	}
 
 	// Write the .scd file
-	outputPath := getSynthPath(cwd, provider, model)
-	synthdefDir := filepath.Join(cwd, "supercollider", "synthdefs")
+	outputPath := getSynthPath(cwd, provider, model, id)
+	synthdefDir := generatedSynthDefDir(cwd)
 	log.Printf("[SYNTHDEF] Writing .scd file to: %s", outputPath)
 
 	synthCode := fmt.Sprintf(SuperColliderSynthTemplate, id, coreLogic)
@@ -57,27 +111,58 @@ func SaveSynthDef(id, provider, model, coreLogic string) error {
 	// Compile the synthdef using compile_synthdef.sh
 	scriptPath := filepath.Join(cwd, "sc", "compile_synthdef.sh")
 	cmd := exec.Command("bash", scriptPath, outputPath, synthdefDir)
-	if output, err := cmd.CombinedOutput(); err != nil {
+	output, err := cmd.CombinedOutput()
+	if err != nil {
 		log.Printf("[SYNTHDEF][ERROR] Failed to compile synthdef: %v\nOutput: %s", err, output)
-		return fmt.Errorf("failed to compile synthdef: %v", err)
+		return newCompileError(err, output)
 	}
 
-	// Verify the synthdef was created
+	// Verify the synthdef was created; sclang reports syntax errors but
+	// still exits cleanly, so this is where most bad code shows up
 	synthdefPath := filepath.Join(synthdefDir, id+".scsyndef")
 	if _, err := os.Stat(synthdefPath); os.IsNotExist(err) {
-		log.Printf("[SYNTHDEF][ERROR] Synthdef file was not created at %s", synthdefPath)
-		return fmt.Errorf("synthdef file was not created")
+		log.Printf("[SYNTHDEF][ERROR] Synthdef file was not created at %s\nOutput: %s", synthdefPath, output)
+		return newCompileError(fmt.Errorf("synthdef file was not created"), output)
 	}
 
 	log.Printf("[SYNTHDEF] Successfully compiled synthdef to %s", synthdefPath)
 	return nil
 }
 
-func formatTimestamp() string {
-	return time.Now().Format("2006_01_02_15_04_05")
+// SaveGenerationLog writes v as <id>.json beside the generated sources for
+// provider/model, so how a def came to be survives with it
+func SaveGenerationLog(id, provider, model string, v interface{}) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %v", err)
+	}
+
+	dir := filepath.Join(cwd, "supercollider", "src", provider, model)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", dir, err)
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, id+".json"), data, 0666)
+}
+
+// GeneratedSynthDefDirectory is where SaveSynthDef compiles defs to
+func GeneratedSynthDefDirectory() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get working directory: %v", err)
+	}
+	return generatedSynthDefDir(cwd), nil
+}
+
+func generatedSynthDefDir(cwd string) string {
+	return filepath.Join(cwd, "supercollider", "synthdefs")
 }
 
-func getSynthPath(cwd, provider, model string) string {
-	timestamp := formatTimestamp()
-	return filepath.Join(cwd, "supercollider", "src", provider, model, timestamp+".scd")
+// named by id, since generations running side by side can share a second
+func getSynthPath(cwd, provider, model, id string) string {
+	return filepath.Join(cwd, "supercollider", "src", provider, model, id+".scd")
 }
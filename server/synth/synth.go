@@ -2,9 +2,13 @@ package synth
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/po-studio/server/config"
 	"github.com/po-studio/server/llm"
 	sc "github.com/po-studio/server/supercollider"
@@ -14,8 +18,15 @@ type Synth interface {
 	Start() error
 	Stop() error
 	GetPort() int
-	SendPlayMessage()
+	SendPlayMessage(synthDefName string, params sc.ControlValues) error
 	SetOnClientName(func(string))
+	SetParams(params sc.ControlValues) (sc.ControlValues, error)
+	GetParams() (sc.ControlValues, error)
+	ActiveSynthDef() string
+	SwitchSynth(synthDefName string, params sc.ControlValues, crossfade time.Duration) error
+	SetOnEvent(func(eventType string, data interface{}))
+	Health() sc.Health
+	ConnectOutputs() error
 }
 
 type SynthType string
@@ -36,39 +47,113 @@ func NewSuperColliderSynth(id string) *sc.SuperColliderSynth {
 	return &sc.SuperColliderSynth{Id: id}
 }
 
-type GenerateSynthRequest struct {
-	Prompt   string `json:"prompt"`
-	Provider string `json:"provider"`
-	Model    string `json:"model"`
-}
-
-func GenerateSynth(w http.ResponseWriter, r *http.Request) {
-	// Check for API key in header
+func authorized(w http.ResponseWriter, r *http.Request) bool {
 	apiKey := r.Header.Get("Awestruck-API-Key")
 	if apiKey == "" {
 		http.Error(w, "Missing API key", http.StatusUnauthorized)
-		return
+		return false
 	}
-
-	// Validate API key
 	if !config.ValidateAwestruckAPIKey(apiKey) {
 		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func writeGenerationJob(w http.ResponseWriter, status int, job llm.Job) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(job)
+}
+
+// GenerateSynth queues a generation and points at its status, since a
+// reasoning model plus sclang takes longer than proxies hold a request open
+func GenerateSynth(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r) {
 		return
 	}
 
-	var req GenerateSynthRequest
+	var req llm.GenerationRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	code, err := llm.GenerateSynthCode(req.Provider, req.Prompt, req.Model)
+	job, err := llm.DefaultJobs().Submit(req)
+	if err != nil {
+		status := http.StatusInternalServerError
+		var unknownProvider *llm.UnknownProviderError
+		switch {
+		case errors.As(err, &unknownProvider):
+			status = http.StatusBadRequest
+		case errors.Is(err, llm.ErrJobQueueFull):
+			w.Header().Set("Retry-After", "60")
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Location", "/generate-synth/"+job.Id)
+	writeGenerationJob(w, http.StatusAccepted, job)
+}
+
+// GenerateSynthStatus reports a generation's state, logs and, once ready,
+// the synthdef it produced
+func GenerateSynthStatus(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r) {
+		return
+	}
+
+	job, err := llm.DefaultJobs().Get(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeGenerationJob(w, http.StatusOK, job)
+}
+
+// ListProviders lists the llm providers GenerateSynth accepts
+func ListProviders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(llm.ProviderNames())
+}
+
+// why we need a synth listing:
+// - clients can offer a choice of synths instead of a random one
+// - exposes declared controls so parameter uis can be built up front
+func ListSynths(w http.ResponseWriter, r *http.Request) {
+	entries, err := sc.DefaultCatalog().List()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list synths: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// ListQuarantined lists generated synthdefs that failed the quality gate,
+// with the measurements that failed them
+func ListQuarantined(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r) {
+		return
+	}
+
+	dir, err := sc.QuarantineDirectory()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	entries := []*sc.CatalogEntry{}
+	// nothing has been quarantined until the directory exists
+	if _, err := os.Stat(dir); err == nil {
+		if entries, err = sc.NewCatalog(dir).List(); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list quarantined synths: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
 
-	fmt.Println(code)
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(code))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
 }
@@ -0,0 +1,84 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/pion/interceptor/pkg/stats"
+	"github.com/pion/webrtc/v3"
+	"github.com/po-studio/server/session"
+	sc "github.com/po-studio/server/supercollider"
+)
+
+// startBitrateControl feeds the receiver's reports for sender's stream to
+// the session's bitrate controller
+func startBitrateControl(appSession *session.AppSession, sender *webrtc.RTPSender, rtpStats stats.Getter) {
+	// interceptors only see rtcp that something reads
+	go func() {
+		for {
+			if _, _, err := sender.ReadRTCP(); err != nil {
+				log.Printf("[%s][BITRATE] Stopped reading RTCP: %v", appSession.Id, err)
+				return
+			}
+		}
+	}()
+
+	if rtpStats == nil {
+		log.Printf("[%s][BITRATE] No RTP stats available, bitrate stays fixed", appSession.Id)
+		return
+	}
+
+	appSession.StartBitrateControl(func() (session.NetworkReport, bool) {
+		encodings := sender.GetParameters().Encodings
+		if len(encodings) == 0 {
+			return session.NetworkReport{}, false
+		}
+		s := rtpStats.Get(uint32(encodings[0].SSRC))
+		if s == nil {
+			return session.NetworkReport{}, false
+		}
+		remote := s.RemoteInboundRTPStreamStats
+		return session.NetworkReport{
+			PacketsReceived: remote.PacketsReceived,
+			PacketsLost:     remote.PacketsLost,
+			RoundTripTime:   remote.RoundTripTime,
+		}, true
+	})
+}
+
+// SessionStats is a snapshot of a session's stream and engine
+type SessionStats struct {
+	SessionId       string                `json:"session_id"`
+	EncodingProfile string                `json:"encoding_profile"`
+	Bitrate         *session.BitrateStats `json:"bitrate,omitempty"`
+	Engine          *sc.Health            `json:"engine,omitempty"`
+}
+
+// HandleSessionStats reports the encoder's current target bitrate along
+// with the loss and rtt it was chosen from
+func HandleSessionStats(w http.ResponseWriter, r *http.Request) {
+	appSession, err := session.GetSession(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, session.ErrSessionNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	response := SessionStats{
+		SessionId:       appSession.Id,
+		EncodingProfile: appSession.Encoding().Name,
+		Bitrate:         appSession.BitrateStats(),
+	}
+	if appSession.Synth != nil {
+		health := appSession.Synth.Health()
+		response.Engine = &health
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,101 @@
+package webrtc
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/po-studio/server/session"
+)
+
+// sse event names on /ice-candidates
+const (
+	candidateEvent       = "candidate"
+	endOfCandidatesEvent = "end-of-candidates"
+)
+
+// HandleServerCandidates streams the server's ICE candidates for the
+// session's peer connection as server-sent events, ending with
+// end-of-candidates, on which the client should close the EventSource so
+// it doesn't reconnect. Each event's id is its position, so a reconnecting
+// EventSource resumes via Last-Event-ID. The session id may be passed as
+// ?session_id= since EventSource can't set headers.
+func HandleServerCandidates(w http.ResponseWriter, r *http.Request) {
+	appSession, err := session.GetSession(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, session.ErrSessionNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	candidates := appSession.LocalCandidates()
+	if candidates == nil {
+		http.Error(w, "No peer connection", http.StatusConflict)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sent := 0
+	if lastEventId, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil && lastEventId > 0 {
+		sent = lastEventId
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	log.Printf("[%s][ICE][SSE] Subscriber connected at candidate %d", appSession.Id, sent)
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+	// gathering gives up on its own by then, but not always with a final
+	// nil candidate
+	deadline := time.NewTimer(iceGatheringTimeout)
+	defer deadline.Stop()
+
+	for {
+		pending, complete, changed := candidates.Since(sent)
+		for _, candidate := range pending {
+			sent++
+			fmt.Fprintf(w, "id: %d\n", sent)
+			if err := writeServerSentEvent(w, candidateEvent, candidate); err != nil {
+				log.Printf("[%s][ICE][SSE] Failed to write candidate: %v", appSession.Id, err)
+				return
+			}
+		}
+		if complete {
+			writeServerSentEvent(w, endOfCandidatesEvent, nil)
+			flusher.Flush()
+			log.Printf("[%s][ICE][SSE] Sent %d candidates", appSession.Id, sent)
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-deadline.C:
+			writeServerSentEvent(w, endOfCandidatesEvent, nil)
+			flusher.Flush()
+			log.Printf("[%s][ICE][SSE] Gave up after %v with %d candidates", appSession.Id, iceGatheringTimeout, sent)
+			return
+		case <-changed:
+		}
+	}
+}
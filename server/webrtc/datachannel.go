@@ -0,0 +1,166 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/po-studio/server/session"
+	sc "github.com/po-studio/server/supercollider"
+)
+
+// why the control channel is negotiated:
+// - both sides create it up front with a fixed id, no extra signaling round
+// - the browser can send on it as soon as the connection is up
+const (
+	controlChannelLabel = "control"
+	controlChannelId    = uint16(0)
+)
+
+// how many events we buffer per channel before dropping
+const controlChannelEventBuffer = 64
+
+// control message types sent by the client
+const (
+	controlSetParams = "set_params"
+	controlGetParams = "get_params"
+	controlSwitch    = "switch"
+	controlSkip      = "skip"
+)
+
+// ControlMessage is a request from the client over the data channel
+type ControlMessage struct {
+	Type string `json:"type"`
+	// echoed back on the reply so the client can match it up
+	Id        string           `json:"id,omitempty"`
+	Synth     string           `json:"synth,omitempty"`
+	Params    sc.ControlValues `json:"params,omitempty"`
+	Crossfade *float64         `json:"crossfade,omitempty"`
+}
+
+// ControlReply answers a ControlMessage. Failures use type "error" with
+// the same status codes the http endpoints would return.
+type ControlReply struct {
+	Type   string      `json:"type"`
+	Id     string      `json:"id,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+	Error  string      `json:"error,omitempty"`
+	Status int         `json:"status,omitempty"`
+}
+
+func createControlChannel(pc *webrtc.PeerConnection) (*webrtc.DataChannel, error) {
+	negotiated := true
+	id := controlChannelId
+	return pc.CreateDataChannel(controlChannelLabel, &webrtc.DataChannelInit{
+		Negotiated: &negotiated,
+		ID:         &id,
+	})
+}
+
+// why we need a control channel:
+// - knob turns shouldn't each cost an http round trip
+// - the server can push now-playing, levels and errors as they happen
+// - it shares the peer connection's lifetime, so cleanup is automatic
+func attachControlChannel(appSession *session.AppSession, dc *webrtc.DataChannel) {
+	var unsubscribe func()
+
+	dc.OnOpen(func() {
+		log.Printf("[%s][DATACHANNEL] Control channel open", appSession.Id)
+
+		events, cancel := appSession.Events.Subscribe(controlChannelEventBuffer)
+		unsubscribe = cancel
+		go forwardSessionEvents(appSession.Id, dc, events)
+
+		if nowPlaying, err := appSession.NowPlaying(); err == nil {
+			sendControlJSON(dc, session.Event{
+				Type:      session.EventNowPlaying,
+				SessionId: appSession.Id,
+				Time:      time.Now(),
+				Data:      nowPlaying,
+			})
+		}
+	})
+
+	dc.OnClose(func() {
+		log.Printf("[%s][DATACHANNEL] Control channel closed", appSession.Id)
+		if unsubscribe != nil {
+			unsubscribe()
+		}
+	})
+
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		if !msg.IsString {
+			sendControlJSON(dc, ControlReply{Type: "error", Error: "binary messages are not supported", Status: http.StatusBadRequest})
+			return
+		}
+
+		var req ControlMessage
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			sendControlJSON(dc, ControlReply{Type: "error", Error: fmt.Sprintf("invalid message: %v", err), Status: http.StatusBadRequest})
+			return
+		}
+
+		sendControlJSON(dc, handleControlMessage(appSession, req))
+	})
+}
+
+func handleControlMessage(appSession *session.AppSession, req ControlMessage) ControlReply {
+	var data interface{}
+	var err error
+
+	switch req.Type {
+	case controlSetParams:
+		data, err = appSession.SetSynthParams(req.Params)
+
+	case controlGetParams:
+		data, err = appSession.NowPlaying()
+
+	case controlSwitch:
+		switchReq := SynthSwitchRequest{Synth: req.Synth, Params: req.Params, Crossfade: req.Crossfade}
+		if err = appSession.SwitchSynth(switchReq.Synth, switchReq.Params, switchReq.crossfade()); err == nil {
+			data, err = appSession.NowPlaying()
+		}
+
+	case controlSkip:
+		var playlist *session.Playlist
+		if playlist, err = appSession.GetPlaylist(); err == nil {
+			err = playlist.Skip()
+		}
+
+	default:
+		return ControlReply{Type: "error", Id: req.Id, Error: fmt.Sprintf("unknown message type %q", req.Type), Status: http.StatusBadRequest}
+	}
+
+	if err != nil {
+		status := synthControlErrorStatus(err)
+		if req.Type == controlSkip {
+			status = playlistErrorStatus(err)
+		}
+		return ControlReply{Type: "error", Id: req.Id, Error: err.Error(), Status: status}
+	}
+	return ControlReply{Type: req.Type, Id: req.Id, Data: data}
+}
+
+func forwardSessionEvents(sessionId string, dc *webrtc.DataChannel, events <-chan session.Event) {
+	for event := range events {
+		if dc.ReadyState() != webrtc.DataChannelStateOpen {
+			continue
+		}
+		sendControlJSON(dc, event)
+	}
+	log.Printf("[%s][DATACHANNEL] Stopped forwarding events", sessionId)
+}
+
+func sendControlJSON(dc *webrtc.DataChannel, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("[DATACHANNEL][ERROR] Failed to encode message: %v", err)
+		return
+	}
+	if err := dc.SendText(string(data)); err != nil {
+		log.Printf("[DATACHANNEL][ERROR] Failed to send message: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/po-studio/server/session"
+)
+
+// chrome and firefox both offer opus on 111
+const opusPayloadType = 111
+
+var opusRtpmap = regexp.MustCompile(`(?mi)^a=rtpmap:(\d+) opus/48000[^\r\n]*`)
+
+// registerOpusProfile registers opus with the profile's fmtp ahead of the
+// defaults, so our track's capability matches what we advertise
+func registerOpusProfile(m *webrtc.MediaEngine, profile session.EncodingProfile) error {
+	return m.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: opusCapability(profile),
+		PayloadType:        opusPayloadType,
+	}, webrtc.RTPCodecTypeAudio)
+}
+
+func opusCapability(profile session.EncodingProfile) webrtc.RTPCodecCapability {
+	return webrtc.RTPCodecCapability{
+		MimeType:    webrtc.MimeTypeOpus,
+		ClockRate:   48000,
+		Channels:    2,
+		SDPFmtpLine: profile.SDPFmtpLine(),
+	}
+}
+
+// why we rewrite the answer's opus fmtp:
+// - pion answers with whatever fmtp the browser offered
+// - the browser only decodes stereo at our bitrate if the answer says so
+// - the payload type stays whatever the browser chose
+func negotiateOpusFmtp(sdp string, profile session.EncodingProfile) string {
+	match := opusRtpmap.FindStringSubmatchIndex(sdp)
+	if match == nil {
+		return sdp
+	}
+	pt := sdp[match[2]:match[3]]
+	fmtp := fmt.Sprintf("a=fmtp:%s %s", pt, profile.SDPFmtpLine())
+
+	existing := regexp.MustCompile(`(?m)^a=fmtp:` + pt + ` [^\r\n]*`)
+	if existing.MatchString(sdp) {
+		return existing.ReplaceAllLiteralString(sdp, fmtp)
+	}
+
+	// no fmtp yet, add one right after the rtpmap
+	eol := "\n"
+	if strings.Contains(sdp, "\r\n") {
+		eol = "\r\n"
+	}
+	return sdp[:match[1]] + eol + fmtp + sdp[match[1]:]
+}
+
+// HandleEncodingProfiles lists the profiles an offer can ask for
+func HandleEncodingProfiles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session.EncodingProfiles())
+}
@@ -0,0 +1,96 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/po-studio/server/session"
+)
+
+// how many events an sse subscriber can fall behind before we drop them
+const eventStreamBuffer = 64
+
+// keeps proxies from closing an idle stream
+const eventStreamKeepAlive = 15 * time.Second
+
+// why we stream over sse as well as the data channel:
+// - dashboards and monitors want levels without holding a peer connection
+// - EventSource reconnects on its own and works through plain http proxies
+func streamSessionEvents(w http.ResponseWriter, r *http.Request, appSession *session.AppSession, types ...string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	wanted := make(map[string]bool, len(types))
+	for _, t := range types {
+		wanted[t] = true
+	}
+
+	events, unsubscribe := appSession.Events.Subscribe(eventStreamBuffer)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if len(wanted) > 0 && !wanted[event.Type] {
+				continue
+			}
+			if err := writeServerSentEvent(w, event.Type, event); err != nil {
+				log.Printf("[%s][SSE] Failed to write event: %v", appSession.Id, err)
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeServerSentEvent(w http.ResponseWriter, eventType string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, data)
+	return err
+}
+
+// HandleLevels streams the session's levels and audio alarms as
+// server-sent events. The session id may be passed as ?session_id= since
+// EventSource can't set headers.
+func HandleLevels(w http.ResponseWriter, r *http.Request) {
+	appSession, err := session.GetSession(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, session.ErrSessionNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	log.Printf("[%s][SSE] Levels subscriber connected", appSession.Id)
+	streamSessionEvents(w, r, appSession, session.EventLevels, session.EventAudioAlarm)
+	log.Printf("[%s][SSE] Levels subscriber disconnected", appSession.Id)
+}
@@ -1,8 +1,11 @@
 package webrtc
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/po-studio/server/session"
 	sc "github.com/po-studio/server/supercollider"
@@ -42,3 +45,164 @@ func HandleSynthCode(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain")
 	w.Write([]byte(code))
 }
+
+type SynthParamsRequest struct {
+	Params sc.ControlValues `json:"params"`
+}
+
+type SynthParamsResponse struct {
+	SynthDef string           `json:"synthdef"`
+	Params   sc.ControlValues `json:"params"`
+}
+
+// why we need a params endpoint:
+// - lets the ui expose knobs for controls the synthdef declares
+// - changes the running node via /n_set without restarting audio
+// - returns the resulting values so knobs stay in sync
+func HandleSynthParams(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Header.Get("X-Session-ID")
+	if sessionID == "" {
+		http.Error(w, "Missing session ID", http.StatusBadRequest)
+		return
+	}
+
+	appSession, err := session.GetOrCreateSession(r, w)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get or create session: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if appSession.Synth == nil {
+		http.Error(w, "No active synth", http.StatusNotFound)
+		return
+	}
+
+	var params sc.ControlValues
+	if r.Method == http.MethodGet {
+		params, err = appSession.Synth.GetParams()
+	} else {
+		var req SynthParamsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if len(req.Params) == 0 {
+			http.Error(w, "No params given", http.StatusBadRequest)
+			return
+		}
+		params, err = appSession.SetSynthParams(req.Params)
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), synthControlErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SynthParamsResponse{
+		SynthDef: appSession.Synth.ActiveSynthDef(),
+		Params:   params,
+	})
+}
+
+// synthControlErrorStatus maps errors from param changes and switches to
+// http statuses; shared with the data channel's error replies
+func synthControlErrorStatus(err error) int {
+	var controlErr *sc.InvalidControlError
+	switch {
+	case errors.Is(err, sc.ErrNoActiveSynth):
+		return http.StatusConflict
+	case errors.Is(err, sc.ErrUnknownSynthDef):
+		return http.StatusNotFound
+	case errors.As(err, &controlErr), errors.Is(err, sc.ErrInvalidCrossfade):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+type SynthSwitchRequest struct {
+	Synth  string           `json:"synth"`
+	Params sc.ControlValues `json:"params,omitempty"`
+	// crossfade length in seconds, defaults to sc.DefaultCrossfade
+	Crossfade *float64 `json:"crossfade,omitempty"`
+}
+
+func (req SynthSwitchRequest) crossfade() time.Duration {
+	if req.Crossfade == nil {
+		return sc.DefaultCrossfade
+	}
+	return time.Duration(*req.Crossfade * float64(time.Second))
+}
+
+// why we need hot-swapping:
+// - changing sounds shouldn't tear down scsynth, jack and the peer connection
+// - a crossfade avoids the click and silence of a stop/offer cycle
+func HandleSynthSwitch(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Header.Get("X-Session-ID")
+	if sessionID == "" {
+		http.Error(w, "Missing session ID", http.StatusBadRequest)
+		return
+	}
+
+	appSession, err := session.GetOrCreateSession(r, w)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get or create session: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if appSession.Synth == nil {
+		http.Error(w, "No active synth", http.StatusNotFound)
+		return
+	}
+
+	var req SynthSwitchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Synth == "" {
+		http.Error(w, "Missing synth", http.StatusBadRequest)
+		return
+	}
+
+	if err := appSession.SwitchSynth(req.Synth, req.Params, req.crossfade()); err != nil {
+		http.Error(w, err.Error(), synthControlErrorStatus(err))
+		return
+	}
+
+	params, err := appSession.Synth.GetParams()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read synth params: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SynthParamsResponse{
+		SynthDef: req.Synth,
+		Params:   params,
+	})
+}
+
+// HandleSynthHealth reports the session's scsynth status. Responds 503 when
+// the engine is stopped or not answering, so it can back a health check.
+func HandleSynthHealth(w http.ResponseWriter, r *http.Request) {
+	appSession, err := session.GetOrCreateSession(r, w)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get or create session: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if appSession.Synth == nil {
+		http.Error(w, "No active synth", http.StatusNotFound)
+		return
+	}
+
+	health := appSession.Synth.Health()
+	w.Header().Set("Content-Type", "application/json")
+	switch health.State {
+	case sc.HealthUnresponsive, sc.HealthStopped:
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(health)
+}
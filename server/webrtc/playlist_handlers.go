@@ -0,0 +1,148 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/po-studio/server/session"
+	sc "github.com/po-studio/server/supercollider"
+)
+
+type PlaylistRequest struct {
+	Entries []session.PlaylistEntry `json:"entries"`
+	Shuffle bool                    `json:"shuffle"`
+	Loop    bool                    `json:"loop"`
+}
+
+type PlaylistQueueRequest struct {
+	Entries []session.PlaylistEntry `json:"entries"`
+}
+
+type PlaylistReorderRequest struct {
+	Order []int `json:"order"`
+}
+
+// playlist requests are all validation up front, so anything we don't
+// recognise is still the client's fault
+func playlistErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, session.ErrNoPlaylist), errors.Is(err, sc.ErrUnknownSynthDef):
+		return http.StatusNotFound
+	case errors.Is(err, sc.ErrNoActiveSynth):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func writePlaylistStatus(w http.ResponseWriter, playlist *session.Playlist) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(playlist.Status())
+}
+
+// HandlePlaylist shows (GET), starts (POST) or stops (DELETE) the session's playlist
+func HandlePlaylist(w http.ResponseWriter, r *http.Request) {
+	appSession, err := session.GetOrCreateSession(r, w)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get or create session: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		playlist, err := appSession.GetPlaylist()
+		if err != nil {
+			http.Error(w, err.Error(), playlistErrorStatus(err))
+			return
+		}
+		writePlaylistStatus(w, playlist)
+
+	case http.MethodPost:
+		var req PlaylistRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		playlist, err := appSession.StartPlaylist(req.Entries, req.Shuffle, req.Loop)
+		if err != nil {
+			http.Error(w, err.Error(), playlistErrorStatus(err))
+			return
+		}
+		writePlaylistStatus(w, playlist)
+
+	case http.MethodDelete:
+		appSession.StopPlaylist()
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// HandlePlaylistQueue appends entries to the running playlist
+func HandlePlaylistQueue(w http.ResponseWriter, r *http.Request) {
+	appSession, err := session.GetOrCreateSession(r, w)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get or create session: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var req PlaylistQueueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	playlist, err := appSession.GetPlaylist()
+	if err == nil {
+		err = playlist.Queue(req.Entries)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), playlistErrorStatus(err))
+		return
+	}
+	writePlaylistStatus(w, playlist)
+}
+
+// HandlePlaylistSkip crossfades straight to the next entry
+func HandlePlaylistSkip(w http.ResponseWriter, r *http.Request) {
+	appSession, err := session.GetOrCreateSession(r, w)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get or create session: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	playlist, err := appSession.GetPlaylist()
+	if err == nil {
+		err = playlist.Skip()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), playlistErrorStatus(err))
+		return
+	}
+	writePlaylistStatus(w, playlist)
+}
+
+// HandlePlaylistReorder rearranges the playlist's entries
+func HandlePlaylistReorder(w http.ResponseWriter, r *http.Request) {
+	appSession, err := session.GetOrCreateSession(r, w)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get or create session: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var req PlaylistReorderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	playlist, err := appSession.GetPlaylist()
+	if err == nil {
+		err = playlist.Reorder(req.Order)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), playlistErrorStatus(err))
+		return
+	}
+	writePlaylistStatus(w, playlist)
+}
@@ -0,0 +1,134 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/po-studio/server/config"
+	"github.com/po-studio/server/session"
+)
+
+type RecordingRequest struct {
+	// ogg (opus), flac or wav; defaults to ogg
+	Format string `json:"format"`
+}
+
+func recordingErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, session.ErrNoRecording), errors.Is(err, session.ErrRecordingNotFound),
+		errors.Is(err, session.ErrSessionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, session.ErrRecordingActive), errors.Is(err, session.ErrNoPipeline):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func writeRecordingInfo(w http.ResponseWriter, status int, info session.RecordingInfo) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(info)
+}
+
+// HandleRecording shows (GET), starts (POST) or stops (DELETE) the
+// session's recording
+func HandleRecording(w http.ResponseWriter, r *http.Request) {
+	appSession, err := session.GetSession(r)
+	if err != nil {
+		http.Error(w, err.Error(), recordingErrorStatus(err))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		recording, err := appSession.GetRecording()
+		if err != nil {
+			http.Error(w, err.Error(), recordingErrorStatus(err))
+			return
+		}
+		writeRecordingInfo(w, http.StatusOK, recording.Info())
+
+	case http.MethodPost:
+		var req RecordingRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+		recording, err := appSession.StartRecording(req.Format)
+		if err != nil {
+			http.Error(w, err.Error(), recordingErrorStatus(err))
+			return
+		}
+		writeRecordingInfo(w, http.StatusCreated, recording.Info())
+
+	case http.MethodDelete:
+		info, err := appSession.StopRecording()
+		if err != nil {
+			http.Error(w, err.Error(), recordingErrorStatus(err))
+			return
+		}
+		writeRecordingInfo(w, http.StatusOK, info)
+	}
+}
+
+// why recordings are scoped to the session unless you have the api key:
+// - a listener should only find what they recorded
+// - operators need to see everything to clean up the directory
+func canAccessRecording(r *http.Request, info session.RecordingInfo) bool {
+	if config.ValidateAwestruckAPIKey(r.Header.Get("Awestruck-API-Key")) {
+		return true
+	}
+	appSession, err := session.GetSession(r)
+	return err == nil && appSession.Id == info.SessionId
+}
+
+// HandleRecordings lists the session's recordings, or every recording
+// when called with the api key
+func HandleRecordings(w http.ResponseWriter, r *http.Request) {
+	sessionId := ""
+	if !config.ValidateAwestruckAPIKey(r.Header.Get("Awestruck-API-Key")) {
+		appSession, err := session.GetSession(r)
+		if err != nil {
+			http.Error(w, err.Error(), recordingErrorStatus(err))
+			return
+		}
+		sessionId = appSession.Id
+	}
+
+	recordings, err := session.ListRecordings(sessionId)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list recordings: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recordings)
+}
+
+// HandleRecordingFile downloads a finished recording's audio
+func HandleRecordingFile(w http.ResponseWriter, r *http.Request) {
+	info, path, err := session.LookupRecording(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), recordingErrorStatus(err))
+		return
+	}
+	// don't reveal other sessions' recordings exist
+	if !canAccessRecording(r, info) {
+		http.Error(w, session.ErrRecordingNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if !info.Finished() {
+		http.Error(w, "Recording is still in progress", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", info.Format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", info.File))
+	http.ServeFile(w, r, path)
+}
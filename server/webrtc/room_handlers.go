@@ -0,0 +1,234 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pion/webrtc/v3"
+	"github.com/po-studio/server/config"
+	"github.com/po-studio/server/session"
+)
+
+func roomErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, session.ErrRoomNotFound), errors.Is(err, session.ErrListenerNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, session.ErrRoomClosed):
+		return http.StatusGone
+	case errors.Is(err, session.ErrUnknownEncodingProfile):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeRoomJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// HandleRooms lists open rooms (GET) or opens a new one (POST, api key)
+func HandleRooms(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		writeRoomJSON(w, http.StatusOK, session.ListRooms())
+		return
+	}
+
+	if !config.ValidateAwestruckAPIKey(r.Header.Get("Awestruck-API-Key")) {
+		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		return
+	}
+
+	var opts session.RoomOptions
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if opts.Synth != "" || len(opts.Params) > 0 {
+		if err := validateRequestedSynth(opts.Synth, opts.Params); err != nil {
+			http.Error(w, err.Error(), synthRequestErrorStatus(err))
+			return
+		}
+	}
+	profile, err := session.LookupEncodingProfile(opts.Profile)
+	if err != nil {
+		http.Error(w, err.Error(), roomErrorStatus(err))
+		return
+	}
+
+	track, err := webrtc.NewTrackLocalStaticSample(opusCapability(profile), "audio", "room")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create audio track: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	room, err := session.NewRoom(opts, track)
+	if err != nil {
+		http.Error(w, err.Error(), roomErrorStatus(err))
+		return
+	}
+	if err := startRoomEngine(room); err != nil {
+		log.Printf("[ROOM][%s][ERROR] Failed to start: %v", room.Id, err)
+		room.Close()
+		http.Error(w, fmt.Sprintf("Failed to start room: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", "/rooms/"+room.Id)
+	writeRoomJSON(w, http.StatusCreated, room.Info())
+}
+
+// startRoomEngine brings up the room's pipeline and synth the same way an
+// offer does, minus the peer connection
+func startRoomEngine(room *session.Room) error {
+	errChan := make(chan error, 2)
+
+	go func() {
+		if err := startMediaPipeline(room.Session, room.Track); err != nil {
+			errChan <- fmt.Errorf("media pipeline error: %v", err)
+			return
+		}
+		errChan <- nil
+	}()
+
+	go func() {
+		if err := startSynthEngine(room.Session); err != nil {
+			errChan <- fmt.Errorf("synth engine error: %v", err)
+			return
+		}
+		errChan <- nil
+	}()
+
+	for i := 0; i < 2; i++ {
+		if err := <-errChan; err != nil {
+			return err
+		}
+	}
+
+	if err := room.Session.PlaySynth(); err != nil {
+		return fmt.Errorf("failed to start synth: %v", err)
+	}
+	return nil
+}
+
+// HandleRoom shows (GET) or closes (DELETE, api key) a room
+func HandleRoom(w http.ResponseWriter, r *http.Request) {
+	room, err := session.GetRoom(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), roomErrorStatus(err))
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		writeRoomJSON(w, http.StatusOK, room.Info())
+		return
+	}
+
+	if !config.ValidateAwestruckAPIKey(r.Header.Get("Awestruck-API-Key")) {
+		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		return
+	}
+	room.Close()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// why joining a room doesn't go through HandleOffer:
+// - there's no per-listener synth, pipeline or session to create
+// - listeners only receive, so the control channel and bitrate loop stay off
+// - the shared encoder can't follow any single listener's network
+func HandleRoomListen(w http.ResponseWriter, r *http.Request) {
+	room, err := session.GetRoom(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), roomErrorStatus(err))
+		return
+	}
+
+	_, offer, err := processOffer(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to process offer: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	profile := room.Session.Encoding()
+	pc, controlChannel, _, err := createPeerConnection(getICEServers(room.Session.Id), room.Session.Id, profile)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create peer connection: %v", err), http.StatusInternalServerError)
+		return
+	}
+	// listeners can't steer a shared synth
+	controlChannel.Close()
+
+	listener, err := room.AddListener(pc)
+	if err != nil {
+		pc.Close()
+		http.Error(w, err.Error(), roomErrorStatus(err))
+		return
+	}
+
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		log.Printf("[ROOM][%s] Listener %s connection state: %s", room.Id, listener.Id, state)
+		// disconnected is often a blip ice recovers from; failed is final
+		if state == webrtc.PeerConnectionStateClosed ||
+			state == webrtc.PeerConnectionStateFailed {
+			room.RemoveListener(listener.Id)
+		}
+	})
+
+	answer, err := answerListener(pc, *offer, profile)
+	if err != nil {
+		room.RemoveListener(listener.Id)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("X-Listener-ID", listener.Id)
+	sendAnswer(w, answer)
+}
+
+// answerListener negotiates a receive-only listener and waits for ICE
+// gathering, since room listeners don't trickle candidates
+func answerListener(pc *webrtc.PeerConnection, offer webrtc.SessionDescription, profile session.EncodingProfile) (*webrtc.SessionDescription, error) {
+	if err := setRemoteDescription(pc, offer); err != nil {
+		return nil, fmt.Errorf("failed to set remote description: %v", err)
+	}
+	answer, err := createAnswer(pc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create answer: %v", err)
+	}
+	answer.SDP = negotiateOpusFmtp(answer.SDP, profile)
+
+	gatherComplete := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(*answer); err != nil {
+		return nil, fmt.Errorf("failed to set local description: %v", err)
+	}
+
+	select {
+	case <-gatherComplete:
+	case <-time.After(iceGatheringTimeout):
+		log.Printf("[ROOM][ICE] Gathering timed out after %v, answering with what we have", iceGatheringTimeout)
+	}
+	return pc.LocalDescription(), nil
+}
+
+// HandleRoomListener disconnects one listener, e.g. when a page unloads
+func HandleRoomListener(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	room, err := session.GetRoom(vars["id"])
+	if err != nil {
+		http.Error(w, err.Error(), roomErrorStatus(err))
+		return
+	}
+	if err := room.RemoveListener(vars["listener"]); err != nil {
+		http.Error(w, err.Error(), roomErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
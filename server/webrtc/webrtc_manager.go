@@ -2,30 +2,42 @@ package webrtc
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os/exec"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/stats"
 	"github.com/pion/webrtc/v3"
 	"github.com/po-studio/server/config"
-	gst "github.com/po-studio/server/internal/gstreamer-src"
 	"github.com/po-studio/server/internal/signal"
+	"github.com/po-studio/server/jack"
 	"github.com/po-studio/server/session"
-	"github.com/po-studio/server/synth"
+	sc "github.com/po-studio/server/supercollider"
 )
 
-// BrowserOffer represents the SDP offer from the browser
+// BrowserOffer represents the SDP offer from the browser. Synth, Params,
+// Profile and Trickle are optional; without them a random synthdef plays
+// with its defaults using the standard encoding profile.
 type BrowserOffer struct {
-	SDP  string `json:"sdp"`
-	Type string `json:"type"`
+	SDP     string           `json:"sdp"`
+	Type    string           `json:"type"`
+	Synth   string           `json:"synth,omitempty"`
+	Params  sc.ControlValues `json:"params,omitempty"`
+	Profile string           `json:"profile,omitempty"`
+	// answer as soon as the local description is set and stream server
+	// candidates from /ice-candidates instead of waiting out gathering
+	Trickle bool `json:"trickle,omitempty"`
 }
 
 type ICECandidateRequest struct {
@@ -37,26 +49,35 @@ type ICECandidateRequest struct {
 	} `json:"candidate"`
 }
 
-// why we need consistent ice credentials:
-// - must match turn server config
-// - ensures authentication works
-// - meets webrtc security requirements
-func getICECredentials() (string, string) {
-	username := config.Get().TurnUsername
-	password := config.Get().TurnPassword
+// why we need ephemeral ice credentials:
+// - a fixed password handed to every client is as good as public
+// - the turn server checks these against the shared secret, no user list
+// - they expire on their own, so leaked ones stop working
+func getICECredentials(sessionID string) (string, string) {
+	cfg := config.Get()
+	username, password := turnRESTCredentials(cfg.TurnSecret, sessionID, time.Now().Add(cfg.TurnCredentialTTL))
 
 	// Log TURN credentials being used (but not the actual values)
 	log.Printf("[TURN] Using credentials for user: %s", username)
 	return username, password
 }
 
+// turnRESTCredentials follows the TURN REST API convention: the username is
+// "<unix expiry>:<user>" and the password is base64(hmac-sha1(secret, username))
+func turnRESTCredentials(secret, user string, expiry time.Time) (string, string) {
+	username := strconv.FormatInt(expiry.Unix(), 10) + ":" + user
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return username, base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
 // why we need consistent port ranges:
 // - matches turn server configuration
 // - ensures reliable ice candidate generation
 // - prevents permission errors
-func getICEServers() []webrtc.ICEServer {
+func getICEServers(sessionID string) []webrtc.ICEServer {
 	hostname := config.Get().TurnServerHost
-	username, password := getICECredentials()
+	username, password := getICECredentials(sessionID)
 
 	// why we need both stun and turn:
 	// - stun for connectivity check
@@ -80,8 +101,14 @@ func getICEServers() []webrtc.ICEServer {
 // - provides ice configuration to client
 // - ensures consistent settings
 func HandleConfig(w http.ResponseWriter, r *http.Request) {
+	// the session id only labels the credentials; the offer may come later
+	sessionID := r.Header.Get("X-Session-ID")
+	if sessionID == "" {
+		sessionID = "anonymous"
+	}
+
 	config := webrtc.Configuration{
-		ICEServers:         getICEServers(),
+		ICEServers:         getICEServers(sessionID),
 		ICETransportPolicy: webrtc.ICETransportPolicyRelay, // Force TURN relay
 	}
 
@@ -91,12 +118,29 @@ func HandleConfig(w http.ResponseWriter, r *http.Request) {
 
 // why we need webrtc settings:
 // - configures global webrtc behavior
-func configureWebRTC() (*webrtc.API, error) {
+func configureWebRTC(profile session.EncodingProfile) (*webrtc.API, *stats.InterceptorFactory, error) {
 	m := &webrtc.MediaEngine{}
+	if err := registerOpusProfile(m, profile); err != nil {
+		return nil, nil, fmt.Errorf("failed to register opus: %v", err)
+	}
 	if err := m.RegisterDefaultCodecs(); err != nil {
-		return nil, fmt.Errorf("failed to register codecs: %v", err)
+		return nil, nil, fmt.Errorf("failed to register codecs: %v", err)
 	}
 
+	// why we need interceptors:
+	// - sender reports let the browser's receiver reports carry rtt
+	// - the stats interceptor turns those reports into loss and rtt for
+	//   the bitrate controller
+	i := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(m, i); err != nil {
+		return nil, nil, fmt.Errorf("failed to register interceptors: %v", err)
+	}
+	statsInterceptor, err := stats.NewInterceptor()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create stats interceptor: %v", err)
+	}
+	i.Add(statsInterceptor)
+
 	// why we need port range settings:
 	// - matches turn server configuration
 	// - ensures consistent port allocation
@@ -119,7 +163,8 @@ func configureWebRTC() (*webrtc.API, error) {
 	return webrtc.NewAPI(
 		webrtc.WithMediaEngine(m),
 		webrtc.WithSettingEngine(s),
-	), nil
+		webrtc.WithInterceptorRegistry(i),
+	), statsInterceptor, nil
 }
 
 // HandleOffer handles the incoming WebRTC offer from the browser and sets up the peer connection.
@@ -140,21 +185,39 @@ func HandleOffer(w http.ResponseWriter, r *http.Request) {
 	// Restore the body for further processing
 	r.Body = io.NopCloser(bytes.NewBuffer(body))
 
-	offer, err := processOffer(r)
+	browserOffer, offer, err := processOffer(r)
 	if err != nil {
 		logWithTime("[OFFER][ERROR] Error processing offer: %v", err)
 		http.Error(w, fmt.Sprintf("Failed to process offer: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	// why we validate the requested synth up front:
+	// - a typo in a "play this track" link should fail fast
+	// - nothing has been allocated yet, so there's nothing to tear down
+	if browserOffer.Synth != "" || len(browserOffer.Params) > 0 {
+		if err := validateRequestedSynth(browserOffer.Synth, browserOffer.Params); err != nil {
+			logWithTime("[OFFER][ERROR] Rejected synth request: %v", err)
+			http.Error(w, err.Error(), synthRequestErrorStatus(err))
+			return
+		}
+	}
+
+	profile, err := session.LookupEncodingProfile(browserOffer.Profile)
+	if err != nil {
+		logWithTime("[OFFER][ERROR] Rejected encoding profile: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	logWithTime("[OFFER] Processed offer details: Type=%s", offer.Type)
 	logWithTime("[OFFER] SDP Preview: %.100s...", offer.SDP)
 
 	// Use server's ICE configuration
-	iceServers := getICEServers()
+	iceServers := getICEServers(sessionID)
 	logWithTime("[WEBRTC] Creating peer connection with ICE servers: %+v", iceServers)
 
-	peerConnection, err := createPeerConnection(iceServers, sessionID)
+	peerConnection, controlChannel, rtpStats, err := createPeerConnection(iceServers, sessionID, profile)
 	if err != nil {
 		logWithTime("[WEBRTC][ERROR] Error creating peer connection: %v", err)
 		http.Error(w, fmt.Sprintf("Failed to create peer connection: %v", err), http.StatusInternalServerError)
@@ -169,8 +232,12 @@ func HandleOffer(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to set session to peer connection: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	appSession.SynthDefName = browserOffer.Synth
+	appSession.InitialParams = browserOffer.Params
+	appSession.EncodingProfile = &profile
+	attachControlChannel(appSession, controlChannel)
 
-	audioTrack, err := prepareMedia(*appSession)
+	audioTrack, err := prepareMedia(appSession, rtpStats)
 	if err != nil {
 		logWithTime("[MEDIA][ERROR] Failed to create audio track: %v", err)
 		http.Error(w, "Failed to create audio track or add to the peer connection: "+err.Error(), http.StatusInternalServerError)
@@ -192,11 +259,12 @@ func HandleOffer(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("Failed to create answer: %v", err), http.StatusInternalServerError)
 		return
 	}
+	answer.SDP = negotiateOpusFmtp(answer.SDP, profile)
 
 	logWithTime("[WEBRTC] Answer SDP: %s", answer.SDP)
 
 	logWithTime("[WEBRTC] Finalizing connection setup")
-	if err := finalizeConnectionSetup(appSession, audioTrack, *answer); err != nil {
+	if err := finalizeConnectionSetup(appSession, audioTrack, *answer, browserOffer.Trickle); err != nil {
 		logWithTime("[WEBRTC][ERROR] Error finalizing connection setup: %v", err)
 		http.Error(w, fmt.Sprintf("Failed to finalize connection setup: %v", err), http.StatusInternalServerError)
 		return
@@ -222,7 +290,10 @@ type connectionState struct {
 // - maintains responsive user experience
 var iceGatheringTimeout = 30 * time.Second
 
-func finalizeConnectionSetup(appSession *session.AppSession, audioTrack *webrtc.TrackLocalStaticSample, answer webrtc.SessionDescription) error {
+// finalizeConnectionSetup starts the engine and applies the answer. With
+// trickle it returns without waiting for gathering; the client takes the
+// remaining candidates from /ice-candidates.
+func finalizeConnectionSetup(appSession *session.AppSession, audioTrack *webrtc.TrackLocalStaticSample, answer webrtc.SessionDescription, trickle bool) error {
 	connState := &connectionState{}
 
 	// Track ICE connection state changes
@@ -289,7 +360,14 @@ func finalizeConnectionSetup(appSession *session.AppSession, audioTrack *webrtc.
 	}
 
 	// Send play message immediately after synth is ready
-	appSession.Synth.SendPlayMessage()
+	if err := appSession.PlaySynth(); err != nil {
+		return fmt.Errorf("failed to start synth: %v", err)
+	}
+
+	if trickle {
+		log.Printf("[ICE] Answering before gathering completes; candidates will trickle")
+		return nil
+	}
 
 	select {
 	case <-gatherComplete:
@@ -379,14 +457,11 @@ func startMediaPipeline(appSession *session.AppSession, audioTrack *webrtc.Track
 		log.Printf("[%s][PIPELINE] Creating pipeline with track ID: %s", appSession.Id, audioTrack.ID())
 		log.Printf("[%s][PIPELINE] Using config: %s", appSession.Id, *appSession.AudioSrc)
 
-		appSession.GStreamerPipeline = gst.CreatePipeline("opus", []*webrtc.TrackLocalStaticSample{audioTrack}, *appSession.AudioSrc)
-
-		if appSession.GStreamerPipeline == nil {
-			log.Printf("[%s][PIPELINE] Failed to create pipeline", appSession.Id)
+		if err := appSession.StartPipeline(audioTrack); err != nil {
+			log.Printf("[%s][PIPELINE] Failed to create pipeline: %v", appSession.Id, err)
 			return
 		}
 
-		appSession.GStreamerPipeline.Start()
 		log.Printf("[%s][PIPELINE] Pipeline created and started", appSession.Id)
 		close(pipelineReady)
 	}()
@@ -415,10 +490,7 @@ func startSynthEngine(appSession *session.AppSession) error {
 
 		// Ensure synth is initialized
 		if appSession.Synth == nil {
-			appSession.Synth = synth.NewSuperColliderSynth(appSession.Id)
-			appSession.Synth.SetOnClientName(func(clientName string) {
-				appSession.JackClientName = clientName
-			})
+			appSession.InitSynth()
 		}
 
 		if err := appSession.Synth.Start(); err != nil {
@@ -544,16 +616,41 @@ func attemptConnectionRecovery(appSession *session.AppSession) {
 }
 
 func checkJACKConnections(appSession *session.AppSession) {
-	cmd := exec.Command("jack_lsp", "-c")
-	output, err := cmd.CombinedOutput()
+	client, err := jack.Default()
 	if err != nil {
 		log.Printf("[%s] Error monitoring JACK: %v", appSession.Id, err)
 		return
 	}
-	log.Printf("[%s] JACK Connections:\n%s", appSession.Id, string(output))
+	log.Printf("[%s] JACK Connections:\n%s", appSession.Id, client.Describe())
 }
 
-func processOffer(r *http.Request) (*webrtc.SessionDescription, error) {
+// params without a synthdef can't be checked against anything, since the
+// def is only picked at random once the synth is running
+var errParamsWithoutSynth = errors.New("params given without a synth to apply them to")
+
+// validateRequestedSynth checks an optional synthdef/params pair from the offer
+func validateRequestedSynth(synthDefName string, params sc.ControlValues) error {
+	if synthDefName == "" {
+		return errParamsWithoutSynth
+	}
+	return sc.ValidateSynthRequest(synthDefName, params)
+}
+
+// synthRequestErrorStatus maps synth validation errors to client errors,
+// leaving anything unexpected (e.g. unreadable synthdef dir) as a 500
+func synthRequestErrorStatus(err error) int {
+	var controlErr *sc.InvalidControlError
+	switch {
+	case errors.Is(err, sc.ErrUnknownSynthDef):
+		return http.StatusNotFound
+	case errors.As(err, &controlErr), errors.Is(err, errParamsWithoutSynth):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func processOffer(r *http.Request) (*BrowserOffer, *webrtc.SessionDescription, error) {
 	var browserOffer BrowserOffer
 
 	// why we need detailed offer logging:
@@ -566,7 +663,7 @@ func processOffer(r *http.Request) (*webrtc.SessionDescription, error) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		log.Printf("[OFFER][ERROR] Failed to read request body: %v", err)
-		return nil, fmt.Errorf("failed to read request body: %v", err)
+		return nil, nil, fmt.Errorf("failed to read request body: %v", err)
 	}
 	log.Printf("[OFFER] Raw request body: %s", string(body))
 
@@ -574,7 +671,7 @@ func processOffer(r *http.Request) (*webrtc.SessionDescription, error) {
 	err = json.Unmarshal(body, &browserOffer)
 	if err != nil {
 		log.Printf("[OFFER][ERROR] JSON decode failed: %v", err)
-		return nil, fmt.Errorf("failed to decode JSON: %v", err)
+		return nil, nil, fmt.Errorf("failed to decode JSON: %v", err)
 	}
 	log.Printf("[OFFER] Decoded browser offer: %+v", browserOffer)
 
@@ -595,7 +692,7 @@ func processOffer(r *http.Request) (*webrtc.SessionDescription, error) {
 		signal.Decode(browserOffer.SDP, &offer)
 	}()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	log.Printf("[OFFER] Decoded SDP: %+v", offer)
 
@@ -603,7 +700,7 @@ func processOffer(r *http.Request) (*webrtc.SessionDescription, error) {
 	mediaEngine := webrtc.MediaEngine{}
 	if err := mediaEngine.RegisterDefaultCodecs(); err != nil {
 		log.Printf("[OFFER][ERROR] Failed to register default codecs: %v", err)
-		return nil, fmt.Errorf("failed to register default codecs: %v", err)
+		return nil, nil, fmt.Errorf("failed to register default codecs: %v", err)
 	}
 
 	// Log detailed SDP analysis
@@ -612,7 +709,7 @@ func processOffer(r *http.Request) (*webrtc.SessionDescription, error) {
 	log.Printf("[OFFER] - SDP Length: %d", len(offer.SDP))
 	log.Printf("[OFFER] - Full SDP:\n%s", offer.SDP)
 
-	return &offer, nil
+	return &browserOffer, &offer, nil
 }
 
 func setSessionToConnection(w http.ResponseWriter, r *http.Request, peerConnection *webrtc.PeerConnection) (*session.AppSession, error) {
@@ -620,6 +717,11 @@ func setSessionToConnection(w http.ResponseWriter, r *http.Request, peerConnecti
 	if err != nil {
 		return nil, err
 	}
+	attachPeerConnection(appSession, peerConnection)
+	return appSession, nil
+}
+
+func attachPeerConnection(appSession *session.AppSession, peerConnection *webrtc.PeerConnection) {
 	appSession.PeerConnection = peerConnection
 
 	// why we need connection state monitoring:
@@ -656,34 +758,34 @@ func setSessionToConnection(w http.ResponseWriter, r *http.Request, peerConnecti
 		}
 	})
 
+	// buffered for /ice-candidates, since trickling clients get the answer
+	// before gathering finishes
+	candidates := appSession.ResetLocalCandidates()
 	peerConnection.OnICECandidate(func(candidate *webrtc.ICECandidate) {
-		if candidate != nil {
-			candidateStr := candidate.String()
-			log.Printf("[ICE] Processing candidate: %s", candidateStr)
+		if candidate == nil {
+			log.Printf("[ICE] Finished gathering candidates for session %s", appSession.Id)
+			candidates.Complete()
+			return
+		}
 
-			// Only send candidates after remote description is set
-			if peerConnection.RemoteDescription() == nil {
-				log.Printf("[ICE] Waiting for remote description before sending candidate")
-				return
-			}
+		candidateStr := candidate.String()
+		log.Printf("[ICE] Processing candidate: %s", candidateStr)
 
-			// Log candidate details for monitoring
-			log.Printf("[ICE] Processing candidate: protocol=%s address=%s port=%d priority=%d type=%s",
-				candidate.Protocol,
-				candidate.Address,
-				candidate.Port,
-				candidate.Priority,
-				candidateStr)
-		}
+		// Log candidate details for monitoring
+		log.Printf("[ICE] Processing candidate: protocol=%s address=%s port=%d priority=%d type=%s",
+			candidate.Protocol,
+			candidate.Address,
+			candidate.Port,
+			candidate.Priority,
+			candidateStr)
+		candidates.Add(candidate.ToJSON())
 	})
-
-	return appSession, nil
 }
 
-func prepareMedia(appSession session.AppSession) (*webrtc.TrackLocalStaticSample, error) {
+func prepareMedia(appSession *session.AppSession, rtpStats stats.Getter) (*webrtc.TrackLocalStaticSample, error) {
 	// Create the audio track
 	audioTrack, err := webrtc.NewTrackLocalStaticSample(
-		webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus},
+		opusCapability(appSession.Encoding()),
 		"audio",
 		"pion1",
 	)
@@ -693,11 +795,12 @@ func prepareMedia(appSession session.AppSession) (*webrtc.TrackLocalStaticSample
 	}
 
 	// Add the audio track to the peer connection
-	_, err = appSession.PeerConnection.AddTrack(audioTrack)
+	sender, err := appSession.PeerConnection.AddTrack(audioTrack)
 	if err != nil {
 		log.Printf("Failed to add audio track: %v\n", err)
 		return nil, err
 	}
+	startBitrateControl(appSession, sender, rtpStats)
 
 	log.Printf("Added audio track with ID: %v\n", audioTrack.ID())
 	return audioTrack, nil
@@ -707,12 +810,18 @@ func prepareMedia(appSession session.AppSession) (*webrtc.TrackLocalStaticSample
 // - forces turn relay to ensure production readiness
 // - logs detailed ice candidate info for debugging
 // - monitors active relay paths
-func createPeerConnection(iceServers []webrtc.ICEServer, sessionID string) (*webrtc.PeerConnection, error) {
-	api, err := configureWebRTC()
+func createPeerConnection(iceServers []webrtc.ICEServer, sessionID string, profile session.EncodingProfile) (*webrtc.PeerConnection, *webrtc.DataChannel, stats.Getter, error) {
+	api, statsInterceptor, err := configureWebRTC(profile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to configure WebRTC: %v", err)
+		return nil, nil, nil, fmt.Errorf("failed to configure WebRTC: %v", err)
 	}
 
+	// called from NewPeerConnection while it builds the interceptors
+	var rtpStats stats.Getter
+	statsInterceptor.OnNewPeerConnection(func(_ string, getter stats.Getter) {
+		rtpStats = getter
+	})
+
 	config := webrtc.Configuration{
 		ICEServers:         iceServers,
 		ICETransportPolicy: webrtc.ICETransportPolicyAll,
@@ -720,7 +829,14 @@ func createPeerConnection(iceServers []webrtc.ICEServer, sessionID string) (*web
 
 	pc, err := api.NewPeerConnection(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create peer connection: %v", err)
+		return nil, nil, nil, fmt.Errorf("failed to create peer connection: %v", err)
+	}
+
+	// negotiated control channel for params, switching and pushed events
+	controlChannel, err := createControlChannel(pc)
+	if err != nil {
+		pc.Close()
+		return nil, nil, nil, fmt.Errorf("failed to create control channel: %v", err)
 	}
 
 	// Monitor ICE gathering
@@ -763,7 +879,7 @@ func createPeerConnection(iceServers []webrtc.ICEServer, sessionID string) (*web
 		}
 	})
 
-	return pc, nil
+	return pc, controlChannel, rtpStats, nil
 }
 
 // setRemoteDescription sets the offer as the remote description for the peer connection
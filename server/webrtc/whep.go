@@ -0,0 +1,265 @@
+package webrtc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pion/webrtc/v3"
+	"github.com/po-studio/server/session"
+)
+
+const (
+	sdpContentType     = "application/sdp"
+	sdpFragContentType = "application/trickle-ice-sdpfrag"
+	// whep resources are sessions; the prefix keeps DELETE /whep/{id} from
+	// reaching sessions made through /offer
+	whepSessionPrefix = "whep-"
+	// an sdp offer is a few kilobytes; anything near this isn't one
+	maxWHEPBodySize = 64 << 10
+)
+
+func hasContentType(r *http.Request, want string) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == want
+}
+
+func readWHEPBody(w http.ResponseWriter, r *http.Request, contentType string) (string, bool) {
+	if !hasContentType(r, contentType) {
+		http.Error(w, fmt.Sprintf("Content-Type must be %s", contentType), http.StatusUnsupportedMediaType)
+		return "", false
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWHEPBodySize))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return "", false
+	}
+	return string(body), true
+}
+
+// why we speak WHEP alongside /offer:
+// - players like OBS and gstreamer's whepsrc only know the standard exchange
+// - plain sdp in and out, no base64 json wrapper or session header
+// - the Location resource carries trickle ice and teardown
+//
+// Synth and profile can be picked with ?synth= and ?profile= since the
+// body has to be bare sdp.
+func HandleWHEP(w http.ResponseWriter, r *http.Request) {
+	body, ok := readWHEPBody(w, r, sdpContentType)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	synthDefName := query.Get("synth")
+	if synthDefName != "" {
+		if err := validateRequestedSynth(synthDefName, nil); err != nil {
+			http.Error(w, err.Error(), synthRequestErrorStatus(err))
+			return
+		}
+	}
+	profile, err := session.LookupEncodingProfile(query.Get("profile"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessionID := newWHEPSessionId()
+	logWithTime("[WHEP] New session %s", sessionID)
+
+	iceServers := getICEServers(sessionID)
+	peerConnection, controlChannel, rtpStats, err := createPeerConnection(iceServers, sessionID, profile)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create peer connection: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	appSession := session.CreateSession(sessionID)
+	attachPeerConnection(appSession, peerConnection)
+	appSession.SynthDefName = synthDefName
+	appSession.EncodingProfile = &profile
+	// only negotiated if the player offered a data channel, which most don't
+	attachControlChannel(appSession, controlChannel)
+
+	fail := func(status int, format string, err error) {
+		logWithTime("[WHEP][ERROR] "+format, err)
+		appSession.StopAllProcesses()
+		session.DeleteSession(sessionID)
+		http.Error(w, fmt.Sprintf(format, err), status)
+	}
+
+	audioTrack, err := prepareMedia(appSession, rtpStats)
+	if err != nil {
+		fail(http.StatusInternalServerError, "Failed to create audio track: %v", err)
+		return
+	}
+
+	offer := webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: body}
+	if err := setRemoteDescription(peerConnection, offer); err != nil {
+		fail(http.StatusBadRequest, "Failed to set remote description: %v", err)
+		return
+	}
+
+	answer, err := createAnswer(peerConnection)
+	if err != nil {
+		fail(http.StatusInternalServerError, "Failed to create answer: %v", err)
+		return
+	}
+	answer.SDP = negotiateOpusFmtp(answer.SDP, profile)
+
+	if err := finalizeConnectionSetup(appSession, audioTrack, *answer, false); err != nil {
+		fail(http.StatusInternalServerError, "Failed to finalize connection setup: %v", err)
+		return
+	}
+
+	for _, link := range iceServerLinks(iceServers) {
+		w.Header().Add("Link", link)
+	}
+	w.Header().Set("Accept-Patch", sdpFragContentType)
+	w.Header().Set("Location", "/whep/"+sessionID)
+	w.Header().Set("Content-Type", sdpContentType)
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, peerConnection.LocalDescription().SDP)
+}
+
+// HandleWHEPResource trickles candidates into (PATCH) or tears down
+// (DELETE) a session made by HandleWHEP
+func HandleWHEPResource(w http.ResponseWriter, r *http.Request) {
+	sessionID := mux.Vars(r)["id"]
+	appSession, ok := lookupWHEPSession(sessionID)
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		logWithTime("[WHEP] Tearing down session %s", sessionID)
+		appSession.StopAllProcesses()
+		session.DeleteSession(sessionID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	body, ok := readWHEPBody(w, r, sdpFragContentType)
+	if !ok {
+		return
+	}
+
+	pc := appSession.PeerConnection
+	if pc == nil || pc.RemoteDescription() == nil {
+		http.Error(w, "No peer connection", http.StatusConflict)
+		return
+	}
+
+	frag := parseTrickleFragment(body)
+	// new credentials mean an ice restart, which would need a fresh answer
+	if frag.ufrag != "" && frag.ufrag != sdpAttribute(pc.RemoteDescription().SDP, "ice-ufrag") {
+		http.Error(w, "ICE restarts are not supported", http.StatusUnprocessableEntity)
+		return
+	}
+
+	for _, candidate := range frag.candidates {
+		if err := pc.AddICECandidate(candidate); err != nil {
+			logWithTime("[WHEP][ERROR] Failed to add candidate for %s: %v", sessionID, err)
+			http.Error(w, fmt.Sprintf("Failed to add candidate: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	logWithTime("[WHEP] Added %d candidates for session %s", len(frag.candidates), sessionID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func lookupWHEPSession(sessionID string) (*session.AppSession, bool) {
+	if !strings.HasPrefix(sessionID, whepSessionPrefix) {
+		return nil, false
+	}
+	return session.LookupSession(sessionID)
+}
+
+// trickleFragment is the part of a trickle-ice-sdpfrag body we act on
+type trickleFragment struct {
+	ufrag      string
+	candidates []webrtc.ICECandidateInit
+}
+
+// parseTrickleFragment reads candidates per media section (RFC 8840),
+// tagging each with the mid of the section it sits in
+func parseTrickleFragment(body string) trickleFragment {
+	var frag trickleFragment
+	var mid string
+	mLineIndex := -1
+
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case strings.HasPrefix(line, "m="):
+			mLineIndex++
+			mid = ""
+		case strings.HasPrefix(line, "a=mid:"):
+			mid = strings.TrimPrefix(line, "a=mid:")
+		case strings.HasPrefix(line, "a=ice-ufrag:"):
+			if frag.ufrag == "" {
+				frag.ufrag = strings.TrimPrefix(line, "a=ice-ufrag:")
+			}
+		case strings.HasPrefix(line, "a=candidate:"):
+			candidate := webrtc.ICECandidateInit{Candidate: strings.TrimPrefix(line, "a=")}
+			// the fragment may list only some sections, so its index is a
+			// fallback for when there's no mid to go by
+			if mid != "" {
+				sdpMid := mid
+				candidate.SDPMid = &sdpMid
+			} else if mLineIndex >= 0 {
+				index := uint16(mLineIndex)
+				candidate.SDPMLineIndex = &index
+			}
+			frag.candidates = append(frag.candidates, candidate)
+		}
+	}
+
+	if frag.ufrag != "" {
+		for i := range frag.candidates {
+			ufrag := frag.ufrag
+			frag.candidates[i].UsernameFragment = &ufrag
+		}
+	}
+	return frag
+}
+
+// sdpAttribute returns the first value of a=<name>: in sdp
+func sdpAttribute(sdp, name string) string {
+	prefix := "a=" + name + ":"
+	for _, line := range strings.Split(sdp, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimPrefix(line, prefix)
+		}
+	}
+	return ""
+}
+
+// iceServerLinks advertises our turn/stun servers the way WHEP clients
+// expect, as Link headers with rel="ice-server"
+func iceServerLinks(iceServers []webrtc.ICEServer) []string {
+	var links []string
+	for _, server := range iceServers {
+		for _, url := range server.URLs {
+			link := fmt.Sprintf(`<%s>; rel="ice-server"`, url)
+			if credential, ok := server.Credential.(string); ok && server.Username != "" {
+				link += fmt.Sprintf(`; username=%q; credential=%q; credential-type="password"`, server.Username, credential)
+			}
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+func newWHEPSessionId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return whepSessionPrefix + hex.EncodeToString(b)
+}
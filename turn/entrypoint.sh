@@ -10,8 +10,8 @@ if [ -z "$PUBLIC_IP" ]; then
     exit 1
 fi
 
-if [ -z "$USERS" ]; then
-    echo "ERROR: USERS environment variable is required"
+if [ -z "$TURN_SECRET" ]; then
+    echo "ERROR: TURN_SECRET environment variable is required"
     exit 1
 fi
 
@@ -27,5 +27,4 @@ echo "Realm: $TURN_REALM"
 exec /app/turn-server \
     -public-ip "$PUBLIC_IP" \
     -port "$UDP_PORT" \
-    -users "$USERS" \
     -realm "$TURN_REALM" 
\ No newline at end of file
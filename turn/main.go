@@ -83,14 +83,13 @@ func main() {
 		panic("TURN_REALM is not set")
 	}
 
-	fixedUsername := os.Getenv("TURN_USERNAME")
-	if fixedUsername == "" {
-		panic("TURN_USERNAME is not set")
-	}
-
-	fixedPassword := os.Getenv("TURN_PASSWORD")
-	if fixedPassword == "" {
-		panic("TURN_PASSWORD is not set")
+	// why we need a shared secret instead of a user list:
+	// - the webrtc server issues "<expiry>:<session id>" usernames per client
+	// - passwords are hmacs of the username, so any we signed can be checked
+	// - expired credentials are refused even if the signature is good
+	sharedSecret := os.Getenv("TURN_SECRET")
+	if sharedSecret == "" {
+		panic("TURN_SECRET is not set")
 	}
 
 	publicIP := os.Getenv("PUBLIC_IP")
@@ -125,14 +124,18 @@ func main() {
 	}
 	defer udpListener.Close()
 
+	// validates the expiry and derives the key the client must have signed with
+	restAuthHandler := turn.LongTermTURNRESTAuthHandler(sharedSecret, turnLogger)
+
 	// Create TURN server configuration
 	config := turn.ServerConfig{
 		Realm: turnRealm,
 		AuthHandler: func(username string, realm string, srcAddr net.Addr) ([]byte, bool) {
 			turnLogger.Debugf("Auth request from %s for user %s", srcAddr.String(), username)
-			if username == fixedUsername {
+			key, ok := restAuthHandler(username, realm, srcAddr)
+			if ok {
 				turnLogger.Debugf("Auth success for user %s", username)
-				return turn.GenerateAuthKey(username, realm, fixedPassword), true
+				return key, true
 			}
 			turnLogger.Debugf("Auth failed for user %s", username)
 			return nil, false